@@ -0,0 +1,168 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/coblo/iscc-golang"
+	"github.com/pkg/errors"
+	"os"
+)
+
+// Verdict thresholds for the Hamming distance of similarity preserving
+// components.
+const (
+	NEAR_DUPLICATE_DISTANCE = 8
+	SIMILAR_DISTANCE        = 16
+)
+
+type componentDistance struct {
+	Name     string `json:"name"`
+	A        string `json:"a"`
+	B        string `json:"b"`
+	Distance int    `json:"distance"`
+}
+
+type compareResult struct {
+	Components        []componentDistance `json:"components"`
+	IdenticalInstance bool                `json:"identical_instance"`
+	Similarity        float64             `json:"similarity,omitempty"`
+	Verdict           string              `json:"verdict"`
+}
+
+func runCompare(args []string) error {
+	flags := flag.NewFlagSet("compare", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print result as JSON")
+	positional, err := parseArgs(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return errors.New("expected two codes or files")
+	}
+
+	a, err := resolveCode(positional[0])
+	if err != nil {
+		return err
+	}
+	b, err := resolveCode(positional[1])
+	if err != nil {
+		return err
+	}
+	result, err := compareCodes(a, b)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return printJSON(result)
+	}
+	for _, c := range result.Components {
+		fmt.Printf("%-17s %s %s  distance %2d\n", c.Name, c.A, c.B, c.Distance)
+	}
+	fmt.Printf("Verdict: %s\n", result.Verdict)
+	return nil
+}
+
+// resolveCode generates the code of an existing file or returns the argument.
+func resolveCode(arg string) (string, error) {
+	if info, err := os.Stat(arg); err == nil && !info.IsDir() {
+		result, err := generate(arg, "", "", false)
+		if err != nil {
+			return "", err
+		}
+		return result.ISCC, nil
+	}
+	return arg, nil
+}
+
+func compareCodes(a, b string) (result compareResult, err error) {
+	// 1. Two full ISCCs
+	codeA, errA := iscc.ParseISCC(a)
+	codeB, errB := iscc.ParseISCC(b)
+	if errA == nil && errB == nil {
+		comparison, err := iscc.Compare(codeA, codeB)
+		if err != nil {
+			return result, err
+		}
+		result.Components = []componentDistance{{"Meta-ID", codeA.MetaId(), codeB.MetaId(), comparison.Meta}}
+		if comparison.Content >= 0 {
+			result.Components = append(result.Components, componentDistance{
+				iscc.ComponentName(codeA.ContentHeader()), codeA.ContentId(), codeB.ContentId(), comparison.Content,
+			})
+		}
+		result.Components = append(result.Components,
+			componentDistance{"Data-ID", codeA.DataId(), codeB.DataId(), comparison.Data},
+			componentDistance{"Instance-ID", codeA.InstanceId(), codeB.InstanceId(), comparison.Instance},
+		)
+		result.IdenticalInstance = comparison.IdenticalInstance
+		result.Similarity = comparison.Similarity
+		result.Verdict = verdict(comparison.IdenticalInstance, comparison.Content, comparison.Data)
+		return result, nil
+	}
+
+	// 2. A single component against the matching component of the other code
+	componentsA, err := splitCode(a)
+	if err != nil {
+		return result, err
+	}
+	componentsB, err := splitCode(b)
+	if err != nil {
+		return result, err
+	}
+	switch {
+	case len(componentsA) == 1:
+		a, b = componentsA[0], matchComponent(componentsA[0], componentsB)
+	case len(componentsB) == 1:
+		a, b = matchComponent(componentsB[0], componentsA), componentsB[0]
+	default:
+		return result, errors.New("can only compare full codes or single components")
+	}
+	d, err := iscc.Distance(a, b)
+	if err != nil {
+		return result, err
+	}
+	info, err := inspectComponent(a)
+	if err != nil {
+		return result, err
+	}
+	result.Components = []componentDistance{{info.Name, a, b, d}}
+	if info.Name == "Instance-ID" {
+		result.IdenticalInstance = d == 0
+		result.Verdict = verdict(d == 0, SIMILAR_DISTANCE+1, SIMILAR_DISTANCE+1)
+	} else {
+		result.Verdict = verdict(false, d, d)
+	}
+	return result, nil
+}
+
+// matchComponent picks the candidate of the same component type.
+func matchComponent(component string, candidates []string) string {
+	info, err := inspectComponent(component)
+	if err != nil {
+		return candidates[0]
+	}
+	for _, candidate := range candidates {
+		if c, err := inspectComponent(candidate); err == nil && c.Name == info.Name {
+			return candidate
+		}
+	}
+	return candidates[0]
+}
+
+// verdict classifies the closest similarity preserving component, a
+// negative content distance means there is no comparable Content-ID.
+func verdict(identicalInstance bool, content, data int) string {
+	closest := content
+	if content < 0 || data < closest {
+		closest = data
+	}
+	switch {
+	case identicalInstance:
+		return "identical"
+	case closest <= NEAR_DUPLICATE_DISTANCE:
+		return "near duplicate"
+	case closest <= SIMILAR_DISTANCE:
+		return "similar"
+	}
+	return "different"
+}
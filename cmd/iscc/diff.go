@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/coblo/iscc-golang"
+	"github.com/pkg/errors"
+	"os"
+)
+
+func runDiff(args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print result as JSON")
+	positional, err := parseArgs(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return errors.New("expected two files")
+	}
+
+	a, err := os.Open(positional[0])
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	b, err := os.Open(positional[1])
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	diff, err := iscc.DiffData(a, b)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return printJSON(diff)
+	}
+	for _, r := range diff.Ranges {
+		marker := "~"
+		if r.Equal {
+			marker = "="
+		}
+		fmt.Printf("%s  a %10d +%-10d  b %10d +%-10d\n", marker, r.AOffset, r.ALength, r.BOffset, r.BLength)
+	}
+	fmt.Printf("Shared: %.1f%% (%d bytes of %d and %d)\n", 100*diff.SharedRatio, diff.SharedBytes, diff.SizeA, diff.SizeB)
+	return nil
+}
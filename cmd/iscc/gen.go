@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/coblo/iscc-golang"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var gmtNames = map[int]string{
+	iscc.GMT_TEXT:    "text",
+	iscc.GMT_IMAGE:   "image",
+	iscc.GMT_AUDIO:   "audio",
+	iscc.GMT_VIDEO:   "video",
+	iscc.GMT_MIXED:   "mixed",
+	iscc.GMT_PRIVATE: "private",
+}
+
+type genResult struct {
+	ISCC       string `json:"iscc"`
+	MetaId     string `json:"meta_id"`
+	ContentId  string `json:"content_id,omitempty"`
+	DataId     string `json:"data_id"`
+	InstanceId string `json:"instance_id"`
+	Tophash    string `json:"tophash"`
+	Gmt        string `json:"gmt,omitempty"`
+	Profile    string `json:"profile"`
+	Title      string `json:"title"`
+	Extra      string `json:"extra,omitempty"`
+}
+
+func runGen(args []string) error {
+	flags := flag.NewFlagSet("gen", flag.ContinueOnError)
+	title := flags.String("title", "", "title for the Meta-ID (default: file name)")
+	extra := flags.String("extra", "", "extra metadata for the Meta-ID")
+	partial := flags.Bool("partial", false, "mark the Content-ID as partial content")
+	asJSON := flags.Bool("json", false, "print result as JSON")
+	positional, err := parseArgs(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("expected exactly one file")
+	}
+	result, err := generate(positional[0], *title, *extra, *partial)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(result)
+	}
+	fmt.Printf("ISCC:    %s\n", result.ISCC)
+	fmt.Printf("Tophash: %s\n", result.Tophash)
+	return nil
+}
+
+// generate creates the full ISCC for a file. Title and extra default to
+// the metadata of HTML, EPUB and office documents, the title to the file
+// name. Files of unsupported media types get an ISCC without Content-ID.
+func generate(path, title, extra string, partial bool) (result genResult, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	generated, err := iscc.Generate(file, iscc.GenerateOptions{
+		Title:             title,
+		Extra:             extra,
+		Partial:           partial,
+		SuggestedMetadata: true,
+		DefaultTitle:      strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+	})
+	if err != nil {
+		return
+	}
+	gmtName := ""
+	if generated.HasContent() {
+		gmtName = gmtNames[generated.Gmt]
+	}
+	return genResult{
+		ISCC:       generated.String(),
+		MetaId:     generated.MetaId(),
+		ContentId:  generated.ContentId(),
+		DataId:     generated.DataId(),
+		InstanceId: generated.InstanceId(),
+		Tophash:    generated.Tophash,
+		Gmt:        gmtName,
+		Profile:    generated.Profile,
+		Title:      generated.Title,
+		Extra:      generated.Extra,
+	}, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/coblo/iscc-golang"
+	"github.com/coblo/iscc-golang/packages/base58"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+type componentInfo struct {
+	Code    string `json:"code"`
+	Header  string `json:"header"`
+	Name    string `json:"name"`
+	Partial bool   `json:"partial"`
+	Bits    string `json:"bits"`
+}
+
+func runInspect(args []string) error {
+	flags := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print result as JSON")
+	positional, err := parseArgs(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("expected exactly one code")
+	}
+
+	components, err := splitCode(positional[0])
+	if err != nil {
+		return err
+	}
+	infos := make([]componentInfo, len(components))
+	for i, component := range components {
+		if infos[i], err = inspectComponent(component); err != nil {
+			return err
+		}
+	}
+
+	if *asJSON {
+		return printJSON(infos)
+	}
+	for _, info := range infos {
+		partial := ""
+		if info.Partial {
+			partial = " (partial content)"
+		}
+		fmt.Printf("%s  %s  %s%s\n", info.Code, info.Header, info.Name, partial)
+		fmt.Printf("               %s\n", info.Bits)
+	}
+	return nil
+}
+
+// splitCode splits a full ISCC or a single component into components.
+func splitCode(code string) ([]string, error) {
+	code = strings.Replace(strings.TrimSpace(code), iscc.CODE_SEPARATOR, "", -1)
+	if len(code) == 0 || len(code)%iscc.COMPONENT_LENGTH != 0 {
+		return nil, errors.Errorf("code must consist of %d char components", iscc.COMPONENT_LENGTH)
+	}
+	var components []string
+	for i := 0; i < len(code); i += iscc.COMPONENT_LENGTH {
+		components = append(components, code[i:i+iscc.COMPONENT_LENGTH])
+	}
+	return components, nil
+}
+
+func inspectComponent(component string) (componentInfo, error) {
+	digest, err := base58.Decode(component)
+	if err != nil {
+		return componentInfo{}, errors.Wrap(err, component)
+	}
+	bits := make([]string, len(digest)-1)
+	for i, b := range digest[1:] {
+		bits[i] = fmt.Sprintf("%08b", b)
+	}
+	return componentInfo{
+		Code:    component,
+		Header:  fmt.Sprintf("0x%02x", digest[0]),
+		Name:    iscc.ComponentName(digest[0]),
+		Partial: iscc.IsPartial(digest[0]),
+		Bits:    strings.Join(bits, " "),
+	}, nil
+}
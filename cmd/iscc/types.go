@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/coblo/iscc-golang"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+type generatorInfo struct {
+	Name          string   `json:"name"`
+	Header        string   `json:"header"`
+	PartialHeader string   `json:"partial_header"`
+	MediaTypes    []string `json:"media_types"`
+}
+
+func runTypes(args []string) error {
+	flags := flag.NewFlagSet("types", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print result as JSON")
+	positional, err := parseArgs(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return errors.New("expected no arguments")
+	}
+
+	var infos []generatorInfo
+	for _, g := range iscc.ContentGenerators() {
+		infos = append(infos, generatorInfo{
+			Name:          g.Name(),
+			Header:        fmt.Sprintf("0x%02x", g.Header()),
+			PartialHeader: fmt.Sprintf("0x%02x", g.PartialHeader()),
+			MediaTypes:    g.MediaTypes(),
+		})
+	}
+
+	if *asJSON {
+		return printJSON(infos)
+	}
+	for _, info := range infos {
+		fmt.Printf("%s  %s  %-18s %s\n", info.Header, info.PartialHeader, info.Name, strings.Join(info.MediaTypes, ", "))
+	}
+	return nil
+}
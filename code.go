@@ -0,0 +1,223 @@
+package iscc
+
+import (
+	"github.com/coblo/iscc-golang/packages/base58"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// Generic media types of the Content-ID component. The value is encoded in
+// bits 1-3 of the Content-ID header byte.
+const (
+	GMT_TEXT  = 0
+	GMT_IMAGE = 1
+	GMT_AUDIO = 2
+	GMT_VIDEO = 3
+	GMT_MIXED = 4
+)
+
+const (
+	COMPONENT_LENGTH = 13
+	CODE_LENGTH      = 4 * COMPONENT_LENGTH
+	CODE_SEPARATOR   = "-"
+)
+
+// NewISCC assembles an ISCC from the four encoded component codes as
+// returned by MetaId, ContentId*, DataId and InstanceId. The Content-ID
+// may be empty for media without a Content-ID generator or a private
+// component with a header from HEAD_PRIVATE_MIN to HEAD_PRIVATE_MAX.
+func NewISCC(mid, cid, did, iid string) (ISCC, error) {
+	var code ISCC
+
+	// 1. Verify component headers
+	if err := verifyHeader(mid, HEAD_MID, HEAD_MID); err != nil {
+		return code, errors.Wrap(err, "Meta-ID")
+	}
+	if cid != "" {
+		if err := verifyContentHeader(cid); err != nil {
+			return code, errors.Wrap(err, "Content-ID")
+		}
+	}
+	if err := verifyHeader(did, HEAD_DID, HEAD_DID); err != nil {
+		return code, errors.Wrap(err, "Data-ID")
+	}
+	if err := verifyHeader(iid, HEAD_IID, HEAD_IID); err != nil {
+		return code, errors.Wrap(err, "Instance-ID")
+	}
+
+	// 2. Derive generic media type and partial content flag
+	if cid != "" {
+		head, _ := componentHeader(cid)
+		code.Gmt = headerGmt(head)
+		code.Partial = IsPartial(head)
+		if code.Gmt == GMT_PRIVATE {
+			code.PrivateHeader = head
+		}
+		copy(code.Content[:], cid[2:])
+	}
+
+	// 3. Store component bodies
+	copy(code.Meta[:], mid[2:])
+	copy(code.Data[:], did[2:])
+	copy(code.Instance[:], iid[2:])
+	return code, nil
+}
+
+// NewISCC assembles an ISCC from components created with the profile and
+// records the profile name in the code.
+func (p Profile) NewISCC(mid, cid, did, iid string) (ISCC, error) {
+	if err := p.Validate(); err != nil {
+		return ISCC{}, err
+	}
+	code, err := NewISCC(mid, cid, did, iid)
+	if err != nil {
+		return ISCC{}, err
+	}
+	code.Profile = p.Name
+	return code, nil
+}
+
+// ParseISCC splits a full ISCC into its components. The components may be
+// separated by hyphens. Codes of three components have no Content-ID.
+func ParseISCC(code string) (ISCC, error) {
+	code = strings.Replace(strings.TrimSpace(code), CODE_SEPARATOR, "", -1)
+	if len(code) == CODE_LENGTH-COMPONENT_LENGTH {
+		return NewISCC(
+			code[0:COMPONENT_LENGTH],
+			"",
+			code[COMPONENT_LENGTH:2*COMPONENT_LENGTH],
+			code[2*COMPONENT_LENGTH:],
+		)
+	}
+	if len(code) != CODE_LENGTH {
+		return ISCC{}, errors.Wrapf(ErrInvalidCodeLength, "ISCC must be %d chars without separators. Not %d", CODE_LENGTH, len(code))
+	}
+	return NewISCC(
+		code[0:COMPONENT_LENGTH],
+		code[COMPONENT_LENGTH:2*COMPONENT_LENGTH],
+		code[2*COMPONENT_LENGTH:3*COMPONENT_LENGTH],
+		code[3*COMPONENT_LENGTH:],
+	)
+}
+
+// ContentHeader returns the Content-ID header byte for the generic media
+// type and partial content flag, the PrivateHeader for private components.
+func (i ISCC) ContentHeader() byte {
+	if i.Gmt == GMT_PRIVATE {
+		return i.PrivateHeader
+	}
+	head := HEAD_CID_T | byte(i.Gmt<<1)
+	if i.Partial {
+		head |= 1
+	}
+	return head
+}
+
+func (i ISCC) MetaId() string {
+	return encodeComponent(HEAD_MID, i.Meta)
+}
+
+// HasContent reports whether the ISCC has a Content-ID.
+func (i ISCC) HasContent() bool {
+	return i.Content != [11]byte{}
+}
+
+// ContentId returns the Content-ID, an empty string if there is none.
+func (i ISCC) ContentId() string {
+	if !i.HasContent() {
+		return ""
+	}
+	return encodeComponent(i.ContentHeader(), i.Content)
+}
+
+func (i ISCC) DataId() string {
+	return encodeComponent(HEAD_DID, i.Data)
+}
+
+func (i ISCC) InstanceId() string {
+	return encodeComponent(HEAD_IID, i.Instance)
+}
+
+// String returns the hyphen separated ISCC.
+func (i ISCC) String() string {
+	if !i.HasContent() {
+		return strings.Join([]string{i.MetaId(), i.DataId(), i.InstanceId()}, CODE_SEPARATOR)
+	}
+	return strings.Join([]string{i.MetaId(), i.ContentId(), i.DataId(), i.InstanceId()}, CODE_SEPARATOR)
+}
+
+// ComponentName returns a readable name for a component header. The
+// partial content flag is ignored. Headers of registered private
+// components are named by their generator.
+func ComponentName(head byte) string {
+	switch head &^ 1 {
+	case HEAD_MID:
+		return "Meta-ID"
+	case HEAD_CID_T:
+		return "Content-ID Text"
+	case HEAD_CID_I:
+		return "Content-ID Image"
+	case HEAD_CID_A:
+		return "Content-ID Audio"
+	case HEAD_CID_V:
+		return "Content-ID Video"
+	case HEAD_CID_M:
+		return "Content-ID Mixed"
+	case HEAD_DID:
+		return "Data-ID"
+	case HEAD_IID:
+		return "Instance-ID"
+	}
+	if g, ok := ContentGeneratorForHeader(head); ok {
+		return g.Name()
+	}
+	return "Unknown"
+}
+
+// IsPartial reports whether a Content-ID header has the partial content flag set.
+func IsPartial(head byte) bool {
+	if head >= HEAD_CID_T && head <= HEAD_CID_M_PCF {
+		return head&1 == 1
+	}
+	g, ok := ContentGeneratorForHeader(head)
+	return ok && head == g.PartialHeader()
+}
+
+func encodeComponent(head byte, body [11]byte) string {
+	encodedHead, _ := base58.Encode([]byte{head})
+	return encodedHead + string(body[:])
+}
+
+func componentHeader(component string) (byte, error) {
+	if len(component) != COMPONENT_LENGTH {
+		return 0, errors.Wrapf(ErrInvalidCodeLength, "Component must be %d chars. Not %d", COMPONENT_LENGTH, len(component))
+	}
+	digest, err := base58.Decode(component)
+	if err != nil {
+		return 0, err
+	}
+	return digest[0], nil
+}
+
+// verifyContentHeader accepts the headers of builtin and private Content-IDs.
+func verifyContentHeader(component string) error {
+	head, err := componentHeader(component)
+	if err != nil {
+		return err
+	}
+	if head >= HEAD_PRIVATE_MIN && head <= HEAD_PRIVATE_MAX {
+		return nil
+	}
+	return verifyHeader(component, HEAD_CID_T, HEAD_CID_M_PCF)
+}
+
+func verifyHeader(component string, min, max byte) error {
+	head, err := componentHeader(component)
+	if err != nil {
+		return err
+	}
+	if head < min || head > max {
+		return &HeaderError{head}
+	}
+	return nil
+}
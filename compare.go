@@ -0,0 +1,84 @@
+package iscc
+
+import (
+	"github.com/coblo/iscc-golang/packages/base58"
+	"github.com/coblo/iscc-golang/packages/hashes"
+	"github.com/pkg/errors"
+)
+
+const COMPONENT_BITS = 64
+
+// Comparison holds the per component Hamming distances of two ISCCs.
+type Comparison struct {
+	Meta int
+	// Content is -1 if one of the ISCCs has no Content-ID or the Content-IDs
+	// are of different type.
+	Content           int
+	Data              int
+	Instance          int
+	IdenticalInstance bool
+	// Similarity is the mean bitwise similarity of the Meta-, Content- and
+	// Data-ID in the range 0 (unrelated) to 1 (identical).
+	Similarity float64
+}
+
+// Distance returns the Hamming distance between the bodies of two encoded
+// components. Components of different type can not be compared. The
+// partial content flag is ignored.
+func Distance(a, b string) (int, error) {
+	// 1. Decode components
+	digestA, err := base58.Decode(a)
+	if err != nil {
+		return 0, err
+	}
+	digestB, err := base58.Decode(b)
+	if err != nil {
+		return 0, err
+	}
+	if len(digestA) != 9 || len(digestB) != 9 {
+		return 0, errors.Wrap(ErrInvalidCodeLength, "Only full components with header can be compared")
+	}
+
+	// 2. Verify component headers match
+	if digestA[0]&^1 != digestB[0]&^1 {
+		return 0, errors.Wrapf(&HeaderError{digestB[0]}, "Can not compare with component 0x%02x", digestA[0])
+	}
+
+	// 3. Count differing bits of the bodies
+	return hashes.HammingDistance(digestA[1:], digestB[1:])
+}
+
+// Compare calculates the Hamming distances of all components of two ISCCs.
+// Unlike Distance it does not fail for Content-IDs of different type.
+// Codes generated with different profiles can not be compared.
+func Compare(a, b ISCC) (c Comparison, err error) {
+	if a.Profile != "" && b.Profile != "" && a.Profile != b.Profile {
+		return c, errors.Wrapf(ErrProfileMismatch, "Profile %q and %q", a.Profile, b.Profile)
+	}
+
+	// 1. Compare components
+	if c.Meta, err = Distance(a.MetaId(), b.MetaId()); err != nil {
+		return
+	}
+	c.Content = -1
+	if a.HasContent() && b.HasContent() && a.ContentHeader()&^1 == b.ContentHeader()&^1 {
+		if c.Content, err = Distance(a.ContentId(), b.ContentId()); err != nil {
+			return
+		}
+	}
+	if c.Data, err = Distance(a.DataId(), b.DataId()); err != nil {
+		return
+	}
+	if c.Instance, err = Distance(a.InstanceId(), b.InstanceId()); err != nil {
+		return
+	}
+	c.IdenticalInstance = c.Instance == 0
+
+	// 2. Normalize similarity of the similarity preserving components
+	if c.Content < 0 {
+		c.Similarity = 1 - float64(c.Meta+c.Data)/(2*COMPONENT_BITS)
+	} else {
+		c.Similarity = 1 - float64(c.Meta+c.Content+c.Data)/(3*COMPONENT_BITS)
+	}
+	return
+}
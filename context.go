@@ -0,0 +1,91 @@
+package iscc
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"io"
+)
+
+// Limits bound the resources a generator spends on untrusted input. Zero
+// values mean no limit.
+type Limits struct {
+	// MaxBytes is the maximum number of bytes read from the input.
+	MaxBytes int64
+	// MaxPixels is the maximum width times height of an image.
+	MaxPixels int64
+}
+
+// DataIdContext is DataId aborting with the error of ctx on cancellation
+// and with a LimitError when r exceeds limits.
+func DataIdContext(ctx context.Context, r io.Reader, limits Limits) (string, error) {
+	return DefaultProfile.DataIdContext(ctx, r, limits)
+}
+
+func (p Profile) DataIdContext(ctx context.Context, r io.Reader, limits Limits) (string, error) {
+	return p.DataId(newLimitedReader(ctx, r, limits))
+}
+
+// InstanceIdContext is InstanceId aborting with the error of ctx on
+// cancellation and with a LimitError when r exceeds limits.
+func InstanceIdContext(ctx context.Context, r io.Reader, limits Limits) (code string, hex_hash string, err error) {
+	return DefaultProfile.InstanceIdContext(ctx, r, limits)
+}
+
+func (p Profile) InstanceIdContext(ctx context.Context, r io.Reader, limits Limits) (code string, hex_hash string, err error) {
+	return p.InstanceId(newLimitedReader(ctx, r, limits))
+}
+
+// ContentIdImageFromFileContext is ContentIdImageFromFile aborting with the
+// error of ctx on cancellation and with a LimitError when the file exceeds
+// limits. The image dimensions are checked before the image is decoded.
+func ContentIdImageFromFileContext(ctx context.Context, reader io.Reader, partial bool, limits Limits) (string, error) {
+	return DefaultProfile.ContentIdImageFromFileContext(ctx, reader, partial, limits)
+}
+
+func (p Profile) ContentIdImageFromFileContext(ctx context.Context, reader io.Reader, partial bool, limits Limits) (string, error) {
+	r := newLimitedReader(ctx, reader, limits)
+
+	// 1. Check dimensions from the image header
+	var head bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(r, &head))
+	if err != nil {
+		return "", err
+	}
+	pixels := int64(config.Width) * int64(config.Height)
+	if limits.MaxPixels > 0 && pixels > limits.MaxPixels {
+		return "", &LimitError{"pixels", limits.MaxPixels, pixels}
+	}
+
+	// 2. Decode the full image
+	return p.ContentIdImageFromFile(io.MultiReader(&head, r), partial)
+}
+
+// limitedReader checks ctx before every read and fails once more than max
+// bytes have been read.
+type limitedReader struct {
+	ctx  context.Context
+	r    io.Reader
+	max  int64
+	read int64
+}
+
+func newLimitedReader(ctx context.Context, r io.Reader, limits Limits) *limitedReader {
+	return &limitedReader{ctx: ctx, r: r, max: limits.MaxBytes}
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if err := l.ctx.Err(); err != nil {
+		return 0, err
+	}
+	// read at most one byte beyond the limit to detect exceeding it
+	if l.max > 0 && int64(len(p)) > l.max-l.read+1 {
+		p = p[:l.max-l.read+1]
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.max > 0 && l.read > l.max {
+		return n, &LimitError{"bytes", l.max, l.read}
+	}
+	return n, err
+}
@@ -0,0 +1,224 @@
+package iscc
+
+import (
+	"crypto/sha256"
+	"github.com/coblo/iscc-golang/packages/cdc"
+	"io"
+)
+
+// DiffRange is a range of chunks that is equal in both files or differs.
+// A differing range may be empty on one side for inserted or removed data.
+type DiffRange struct {
+	Equal   bool  `json:"equal"`
+	AOffset int64 `json:"a_offset"`
+	ALength int64 `json:"a_length"`
+	BOffset int64 `json:"b_offset"`
+	BLength int64 `json:"b_length"`
+}
+
+// DataDiff describes the differences of two files on the level of the
+// content defined chunks of the Data-ID.
+type DataDiff struct {
+	Ranges      []DiffRange `json:"ranges"`
+	SizeA       int64       `json:"size_a"`
+	SizeB       int64       `json:"size_b"`
+	SharedBytes int64       `json:"shared_bytes"`
+	// SharedRatio is the share of equal bytes in both files between 0 and 1.
+	SharedRatio float64 `json:"shared_ratio"`
+}
+
+type chunkRef struct {
+	offset int64
+	length int64
+	digest [32]byte
+}
+
+// DiffData aligns the content defined chunks of two streams and returns the
+// equal and differing ranges.
+func DiffData(a, b io.Reader) (*DataDiff, error) {
+	return DefaultProfile.DiffData(a, b)
+}
+
+func (p Profile) DiffData(a, b io.Reader) (*DataDiff, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	// 1. Chunk both streams
+	chunksA, err := chunkRefs(a, p.Chunking)
+	if err != nil {
+		return nil, err
+	}
+	chunksB, err := chunkRefs(b, p.Chunking)
+	if err != nil {
+		return nil, err
+	}
+	diff := &DataDiff{SizeA: streamSize(chunksA), SizeB: streamSize(chunksB)}
+
+	// 2. Align chunks by their digests
+	matches := alignChunks(chunksA, chunksB)
+
+	// 3. Merge into ranges
+	i, j := 0, 0
+	addRange := func(equal bool, endA, endB int) {
+		if endA == i && endB == j {
+			return
+		}
+		r := DiffRange{Equal: equal, AOffset: rangeOffset(chunksA, i, diff.SizeA), BOffset: rangeOffset(chunksB, j, diff.SizeB)}
+		r.ALength = rangeOffset(chunksA, endA, diff.SizeA) - r.AOffset
+		r.BLength = rangeOffset(chunksB, endB, diff.SizeB) - r.BOffset
+		if equal {
+			diff.SharedBytes += r.ALength
+		}
+		if n := len(diff.Ranges); n > 0 && diff.Ranges[n-1].Equal == equal {
+			diff.Ranges[n-1].ALength += r.ALength
+			diff.Ranges[n-1].BLength += r.BLength
+		} else {
+			diff.Ranges = append(diff.Ranges, r)
+		}
+		i, j = endA, endB
+	}
+	for _, m := range matches {
+		addRange(false, m[0], m[1])
+		addRange(true, m[0]+1, m[1]+1)
+	}
+	addRange(false, len(chunksA), len(chunksB))
+
+	if total := diff.SizeA + diff.SizeB; total > 0 {
+		diff.SharedRatio = float64(2*diff.SharedBytes) / float64(total)
+	} else {
+		diff.SharedRatio = 1
+	}
+	return diff, nil
+}
+
+func chunkRefs(r io.Reader, params cdc.Params) ([]chunkRef, error) {
+	var refs []chunkRef
+	chunker := cdc.NewChunkerWithParams(r, params)
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			return refs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, chunkRef{chunk.Offset, int64(chunk.Length), sha256.Sum256(chunk.Data)})
+	}
+}
+
+func streamSize(chunks []chunkRef) int64 {
+	if len(chunks) == 0 {
+		return 0
+	}
+	last := chunks[len(chunks)-1]
+	return last.offset + last.length
+}
+
+func rangeOffset(chunks []chunkRef, index int, size int64) int64 {
+	if index == len(chunks) {
+		return size
+	}
+	return chunks[index].offset
+}
+
+// DIFF_MAX_EDITS bounds the number of chunk insertions and removals
+// alignChunks searches for. Memory grows quadratically with it. Beyond it
+// all chunks between the common prefix and suffix are reported as changed.
+const DIFF_MAX_EDITS = 2048
+
+// alignChunks returns the index pairs of a longest common subsequence of
+// equal chunks. Common prefix and suffix are matched directly, the rest is
+// aligned with the O(ND) difference algorithm by Myers.
+func alignChunks(a, b []chunkRef) [][2]int {
+	// 1. Common prefix and suffix
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix].digest == b[prefix].digest {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix].digest == b[len(b)-1-suffix].digest {
+		suffix++
+	}
+
+	// 2. Align the middle
+	middle := shortestEdit(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix], DIFF_MAX_EDITS)
+	matches := make([][2]int, 0, prefix+len(middle)+suffix)
+	for i := 0; i < prefix; i++ {
+		matches = append(matches, [2]int{i, i})
+	}
+	for _, m := range middle {
+		matches = append(matches, [2]int{m[0] + prefix, m[1] + prefix})
+	}
+	for i := suffix; i > 0; i-- {
+		matches = append(matches, [2]int{len(a) - i, len(b) - i})
+	}
+	return matches
+}
+
+// shortestEdit returns the matches of the shortest edit script of at most
+// maxEdits edits, none if the script is longer.
+func shortestEdit(a, b []chunkRef, maxEdits int) [][2]int {
+	n, m := len(a), len(b)
+	max := n + m
+	if max > maxEdits {
+		max = maxEdits
+	}
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+	// 1. Find the shortest edit script, remembering the furthest reaching
+	// paths of every round
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x].digest == b[y].digest {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, n, m)
+			}
+		}
+	}
+	return nil
+}
+
+func backtrack(trace [][]int, x, y int) [][2]int {
+	var matches [][2]int
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		at := func(k int) int { return v[k+d+1] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			matches = append(matches, [2]int{x, y})
+		}
+		if d > 0 {
+			x, y = prevX, prevY
+		}
+	}
+	// reverse to file order
+	for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+		matches[i], matches[j] = matches[j], matches[i]
+	}
+	return matches
+}
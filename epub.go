@@ -0,0 +1,85 @@
+package iscc
+
+import (
+	"github.com/coblo/iscc-golang/packages/epub"
+	"image"
+	"io"
+	"strings"
+)
+
+// EPUB_MIN_IMAGE_SIZE is the minimum width and height of images that are
+// part of the Content-ID of an EPUB. Smaller images are icons or ornaments.
+const EPUB_MIN_IMAGE_SIZE = 256
+
+// ContentIdEPUB creates the Content-ID of the EPUB of size bytes in r. The
+// text of the spine documents gives a text Content-ID, which is combined
+// with the Content-IDs of significant images to a mixed Content-ID. The
+// text weighs as much as all images together. Missing or undecodable
+// images are skipped. It also returns the title and the creators as
+// suggested title and extra for the Meta-ID.
+func ContentIdEPUB(r io.ReaderAt, size int64, partial bool) (contentId, title, creators string, err error) {
+	return DefaultProfile.ContentIdEPUB(r, size, partial)
+}
+
+func (p Profile) ContentIdEPUB(r io.ReaderAt, size int64, partial bool) (contentId, title, creators string, err error) {
+	book, err := epub.Open(r, size)
+	if err != nil {
+		return
+	}
+	title, creators = book.Title, strings.Join(book.Creators, ", ")
+
+	// 1. Text Content-ID of the spine in reading order
+	text, err := book.Text()
+	if err != nil {
+		return
+	}
+	text = textJoinLines(text)
+	textId, err := p.ContentIdText(text, false)
+	if err != nil {
+		return
+	}
+
+	// 2. Image Content-IDs of significant images
+	var imageIds []string
+	for _, name := range book.Images {
+		if imageId, ok := p.epubImageId(book, name); ok {
+			imageIds = append(imageIds, imageId)
+		}
+	}
+	if len(imageIds) == 0 {
+		contentId, err = p.ContentIdText(text, partial)
+		return
+	}
+
+	// 3. Combine to a mixed Content-ID with one text vote per image
+	cids := make([]string, 0, 2*len(imageIds))
+	for range imageIds {
+		cids = append(cids, textId)
+	}
+	contentId, err = p.ContentIdMixed(append(cids, imageIds...), partial)
+	return
+}
+
+// epubImageId creates the Content-ID of an image of the book if it is at
+// least EPUB_MIN_IMAGE_SIZE pixels wide and high. Images missing from the
+// archive and undecodable formats like SVG are reported as not ok.
+func (p Profile) epubImageId(book *epub.Book, name string) (contentId string, ok bool) {
+	// 1. Check dimensions
+	file, err := book.Open(name)
+	if err != nil {
+		return "", false
+	}
+	config, _, err := image.DecodeConfig(file)
+	file.Close()
+	if err != nil || config.Width < EPUB_MIN_IMAGE_SIZE || config.Height < EPUB_MIN_IMAGE_SIZE {
+		return "", false
+	}
+
+	// 2. Decode image
+	if file, err = book.Open(name); err != nil {
+		return "", false
+	}
+	defer file.Close()
+	contentId, err = p.ContentIdImageFromFile(file, false)
+	return contentId, err == nil
+}
@@ -0,0 +1,101 @@
+package iscc
+
+import (
+	"fmt"
+	"github.com/coblo/iscc-golang/packages/base58"
+	"github.com/coblo/iscc-golang/packages/hashes"
+	"github.com/coblo/iscc-golang/packages/y4m"
+	"github.com/pkg/errors"
+)
+
+// Sentinel errors for use with errors.Is. Errors of the base58, hashes
+// and y4m packages are the same values as their iscc counterparts.
+var (
+	ErrUnsupportedVersion  = errors.New("Only version 1 is supported")
+	ErrUnknownHeader       = base58.ErrUnknownHeader
+	ErrInvalidCodeLength   = base58.ErrInvalidCodeLength
+	ErrInvalidCharacter    = base58.ErrInvalidCharacter
+	ErrInconsistentDigests = hashes.ErrInconsistentDigests
+	ErrInvalidDigestLength = hashes.ErrInvalidDigestLength
+	ErrEmptyInput          = hashes.ErrEmptyInput
+	ErrInvalidSampleRate   = hashes.ErrInvalidSampleRate
+	ErrInvalidFrameSize    = y4m.ErrInvalidFrameSize
+	ErrInvalidWindowWidth  = errors.New("Sliding window width must be 2 or bigger")
+	ErrInvalidSize         = errors.New("Size must not be negative")
+	ErrChunkOutOfRange     = errors.New("Chunk index out of range")
+	ErrProfileMismatch     = errors.New("Codes of different profiles can not be compared")
+	ErrAlreadyRegistered   = errors.New("Already registered")
+)
+
+// HeaderError reports a component header outside the expected range.
+type HeaderError struct {
+	Header byte
+}
+
+func (e *HeaderError) Error() string {
+	return fmt.Sprintf("Unexpected component header 0x%02x", e.Header)
+}
+
+func (e *HeaderError) Is(target error) bool {
+	return target == ErrUnknownHeader
+}
+
+// ErrInvalidProfile matches every ProfileError.
+var ErrInvalidProfile = errors.New("Invalid profile")
+
+// ProfileError reports a profile parameter that can not produce codes.
+type ProfileError struct {
+	Profile string
+	Reason  string
+	// Err is the underlying error, e.g. ErrInvalidWindowWidth, if any.
+	Err error
+}
+
+func (e *ProfileError) Error() string {
+	return fmt.Sprintf("Invalid profile %q: %s", e.Profile, e.Reason)
+}
+
+func (e *ProfileError) Is(target error) bool {
+	return target == ErrInvalidProfile
+}
+
+func (e *ProfileError) Unwrap() error {
+	return e.Err
+}
+
+// ErrLimitExceeded matches every LimitError.
+var ErrLimitExceeded = errors.New("Limit exceeded")
+
+// LimitError reports an input exceeding one of the Limits.
+type LimitError struct {
+	// Limit is the name of the exceeded limit, "bytes" or "pixels".
+	Limit string
+	Max   int64
+	// Actual is the size of the input, for bytes the number read when
+	// exceeding the limit was detected.
+	Actual int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("Input exceeds %d %s with %d", e.Max, e.Limit, e.Actual)
+}
+
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// ErrUnsupportedMedia matches every MediaTypeError.
+var ErrUnsupportedMedia = errors.New("Unsupported media type")
+
+// MediaTypeError reports a media type without a Content-ID generator.
+type MediaTypeError struct {
+	MediaType string
+}
+
+func (e *MediaTypeError) Error() string {
+	return fmt.Sprintf("Unsupported media type %s", e.MediaType)
+}
+
+func (e *MediaTypeError) Is(target error) bool {
+	return target == ErrUnsupportedMedia
+}
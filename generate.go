@@ -0,0 +1,274 @@
+package iscc
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/coblo/iscc-golang/packages/epub"
+	"github.com/coblo/iscc-golang/packages/office"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	SNIFF_LENGTH   = 512
+	MEDIA_TYPE_Y4M = "video/x-yuv4mpeg"
+)
+
+// GenerateOptions configures GenerateFromReader.
+type GenerateOptions struct {
+	Title   string
+	Extra   string
+	Partial bool
+	// ContentId is used instead of decoding the content if set.
+	ContentId string
+	// Profile defaults to DefaultProfile.
+	Profile *Profile
+	// SuggestedMetadata fills an empty Title and Extra with the title and
+	// creators suggested by HTML, EPUB and office documents.
+	SuggestedMetadata bool
+	// DefaultTitle is the title if neither Title nor the suggested metadata
+	// give one, e.g. the file name.
+	DefaultTitle string
+}
+
+// Generated is a full ISCC with its tophash and the processed title and
+// extra of its Meta-ID.
+type Generated struct {
+	ISCC
+	Tophash string
+	Title   string
+	Extra   string
+}
+
+// GenerateFromReader creates a full ISCC from a single pass over r. The
+// Data-ID, Instance-ID and Content-ID are computed concurrently from the
+// same stream. It returns the ISCC and the hex encoded tophash. Media types
+// without a Content-ID generator yield an ISCC without Content-ID.
+func GenerateFromReader(r io.Reader, opts GenerateOptions) (code ISCC, tophash string, err error) {
+	generated, err := Generate(r, opts)
+	if err != nil {
+		return ISCC{}, "", err
+	}
+	return generated.ISCC, generated.Tophash, nil
+}
+
+// Generate is GenerateFromReader also returning the metadata the Meta-ID
+// was created from.
+func Generate(r io.Reader, opts GenerateOptions) (*Generated, error) {
+	p := DefaultProfile
+	if opts.Profile != nil {
+		p = *opts.Profile
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	// 1. Sniff media type from the head of the stream
+	buffered := bufio.NewReaderSize(r, SNIFF_LENGTH)
+	head, err := buffered.Peek(SNIFF_LENGTH)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	var content ContentGenerator
+	if opts.ContentId == "" {
+		content, err = p.detectGenerator(head)
+		if errors.Is(err, ErrUnsupportedMedia) {
+			err = nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	// 2. Fan out the stream to the component generators
+	var (
+		wg                           sync.WaitGroup
+		writers                      []io.Writer
+		pipes                        []*io.PipeWriter
+		did, iid, cid, tophash       string
+		suggested                    metadata
+		dataErr, instanceErr, cidErr error
+	)
+	consume := func(run func(io.Reader)) {
+		pr, pw := io.Pipe()
+		pipes = append(pipes, pw)
+		writers = append(writers, pw)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run(pr)
+			// generators may stop before the end of the stream
+			io.Copy(io.Discard, pr)
+		}()
+	}
+	consume(func(r io.Reader) { did, dataErr = p.DataId(r) })
+	consume(func(r io.Reader) { iid, tophash, instanceErr = p.InstanceId(r) })
+	if content != nil {
+		consume(func(r io.Reader) { cid, suggested, cidErr = generateContentId(content, r, opts.Partial) })
+	} else {
+		cid = opts.ContentId
+	}
+
+	_, err = io.Copy(io.MultiWriter(writers...), buffered)
+	for _, pw := range pipes {
+		pw.CloseWithError(err)
+	}
+	wg.Wait()
+
+	if err != nil {
+		return nil, err
+	}
+	if dataErr != nil {
+		return nil, dataErr
+	}
+	if instanceErr != nil {
+		return nil, instanceErr
+	}
+	if errors.Is(cidErr, ErrUnsupportedMedia) {
+		cid, cidErr = "", nil
+	}
+	if cidErr != nil {
+		return nil, cidErr
+	}
+
+	// 3. Meta-ID from the given, suggested or default metadata
+	title, extra := opts.Title, opts.Extra
+	if opts.SuggestedMetadata {
+		if title == "" {
+			title = suggested.title
+		}
+		if extra == "" {
+			extra = suggested.extra
+		}
+	}
+	if title == "" {
+		title = opts.DefaultTitle
+	}
+	mid, title, extra, err := p.MetaId(title, extra, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	// 4. Assemble the ISCC
+	code, err := p.NewISCC(mid, cid, did, iid)
+	if err != nil {
+		return nil, err
+	}
+	return &Generated{code, tophash, title, extra}, nil
+}
+
+// ContentIdAuto detects the media type of r from its magic bytes and MIME
+// type and creates the Content-ID with the registered generator. The
+// generic media type is GMT_PRIVATE for private components. Media types
+// without a generator fail with a MediaTypeError.
+func ContentIdAuto(r io.Reader, partial bool) (contentId string, gmt int, err error) {
+	return DefaultProfile.ContentIdAuto(r, partial)
+}
+
+func (p Profile) ContentIdAuto(r io.Reader, partial bool) (contentId string, gmt int, err error) {
+	// 1. Sniff media type from the head of the stream
+	buffered := bufio.NewReaderSize(r, SNIFF_LENGTH)
+	head, err := buffered.Peek(SNIFF_LENGTH)
+	if err != nil && err != io.EOF {
+		return
+	}
+	g, err := p.detectGenerator(head)
+	if err != nil {
+		return
+	}
+
+	// 2. Dispatch to the generator
+	if contentId, _, err = generateContentId(g, buffered, partial); err != nil {
+		return "", 0, err
+	}
+	cidHead, err := componentHeader(contentId)
+	return contentId, headerGmt(cidHead), err
+}
+
+// metadata is the title and extra for the Meta-ID suggested by a document.
+type metadata struct {
+	title string
+	extra string
+}
+
+// contentGenerator returns the Content-ID generator for a generic media
+// type. Generators of documents also return their suggested metadata.
+func (p Profile) contentGenerator(gmt int) func(io.Reader, bool) (string, metadata, error) {
+	withoutMetadata := func(generate func(io.Reader, bool) (string, error)) func(io.Reader, bool) (string, metadata, error) {
+		return func(r io.Reader, partial bool) (string, metadata, error) {
+			cid, err := generate(r, partial)
+			return cid, metadata{}, err
+		}
+	}
+	switch gmt {
+	case GMT_TEXT:
+		return func(r io.Reader, partial bool) (string, metadata, error) {
+			text, err := io.ReadAll(r)
+			if err != nil {
+				return "", metadata{}, err
+			}
+			switch mediaType := detectMediaType(text); {
+			case mediaType == "text/html":
+				cid, title, err := p.ContentIdHTML(bytes.NewReader(text), partial)
+				return cid, metadata{title: title}, err
+			case office.Detect(text) != "":
+				cid, title, creators, err := p.ContentIdOffice(bytes.NewReader(text), int64(len(text)), partial)
+				if errors.Is(err, office.ErrUnsupportedFormat) {
+					return "", metadata{}, &MediaTypeError{mediaType}
+				}
+				return cid, metadata{title, creators}, err
+			}
+			cid, err := p.ContentIdText(string(text), partial)
+			return cid, metadata{}, err
+		}
+	case GMT_IMAGE:
+		return withoutMetadata(p.ContentIdImageFromFile)
+	case GMT_AUDIO:
+		return withoutMetadata(p.ContentIdAudioFromFile)
+	case GMT_VIDEO:
+		return withoutMetadata(p.ContentIdVideoFromFile)
+	case GMT_MIXED:
+		// mixed media files are EPUB publications
+		return func(r io.Reader, partial bool) (string, metadata, error) {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return "", metadata{}, err
+			}
+			cid, title, creators, err := p.ContentIdEPUB(bytes.NewReader(data), int64(len(data)), partial)
+			return cid, metadata{title, creators}, err
+		}
+	}
+	return nil
+}
+
+// detectGenerator returns the registered generator for the media type of
+// the head of a file. Builtin generators use the parameters of p.
+func (p Profile) detectGenerator(head []byte) (ContentGenerator, error) {
+	mediaType := detectMediaType(head)
+	g, ok := ContentGeneratorForMediaType(mediaType)
+	if !ok {
+		return nil, &MediaTypeError{mediaType}
+	}
+	return withProfile(g, p), nil
+}
+
+// detectMediaType determines the MIME type without parameters from the
+// head of a file.
+func detectMediaType(head []byte) string {
+	if bytes.HasPrefix(head, []byte("YUV4MPEG2")) {
+		return MEDIA_TYPE_Y4M
+	}
+	if epub.IsEPUB(head) {
+		return epub.MEDIA_TYPE
+	}
+	if mediaType := office.Detect(head); mediaType != "" {
+		return mediaType
+	}
+	mediaType := http.DetectContentType(head)
+	if i := strings.Index(mediaType, ";"); i >= 0 {
+		mediaType = mediaType[:i]
+	}
+	return mediaType
+}
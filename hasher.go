@@ -0,0 +1,144 @@
+package iscc
+
+import (
+	"github.com/coblo/iscc-golang/packages/base58"
+	"github.com/coblo/iscc-golang/packages/cdc"
+	"github.com/coblo/iscc-golang/packages/hashes"
+	"hash"
+)
+
+const INSTANCE_CHUNK_SIZE = 64000
+
+var (
+	_ hash.Hash = (*DataHasher)(nil)
+	_ hash.Hash = (*InstanceHasher)(nil)
+)
+
+// DataHasher computes the Data-ID of the data written to it.
+type DataHasher struct {
+	chunker *cdc.Hasher
+	params  cdc.Params
+}
+
+func NewDataHasher() *DataHasher {
+	hasher, _ := DefaultProfile.NewDataHasher()
+	return hasher
+}
+
+func (p Profile) NewDataHasher() (*DataHasher, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &DataHasher{cdc.NewHasherWithParams(p.Chunking), p.Chunking}, nil
+}
+
+func (d *DataHasher) Write(p []byte) (int, error) {
+	return d.chunker.Write(p)
+}
+
+// Sum appends the 8-byte Data-ID digest without header to b.
+func (d *DataHasher) Sum(b []byte) []byte {
+	// 1. Apply minimum hash to chunk features
+	mhash := hashes.MinHash(d.chunker.Features())
+
+	// 2. Collect lsb and create 64-bit digests
+	lsb := getLSBDigests(mhash)
+
+	// 3. Apply simhash
+	simHash, _ := hashes.SimilarityHash(lsb)
+	return append(b, simHash...)
+}
+
+// Code returns the encoded Data-ID.
+func (d *DataHasher) Code() (string, error) {
+	return base58.Encode(append([]byte{HEAD_DID}, d.Sum(nil)...))
+}
+
+func (d *DataHasher) Reset() {
+	d.chunker.Reset()
+}
+
+func (d *DataHasher) Size() int {
+	return 8
+}
+
+func (d *DataHasher) BlockSize() int {
+	return d.params.Gear1.Max
+}
+
+// InstanceHasher computes the Instance-ID of the data written to it.
+type InstanceHasher struct {
+	chunkSize       int
+	chunk           []byte
+	leafNodeDigests [][32]byte
+}
+
+func NewInstanceHasher() *InstanceHasher {
+	hasher, _ := DefaultProfile.NewInstanceHasher()
+	return hasher
+}
+
+func (p Profile) NewInstanceHasher() (*InstanceHasher, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &InstanceHasher{chunkSize: p.InstanceChunkSize, chunk: make([]byte, 0, p.InstanceChunkSize)}, nil
+}
+
+func (i *InstanceHasher) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		// 1. Fill the current chunk
+		free := i.chunkSize - len(i.chunk)
+		if free > len(p) {
+			free = len(p)
+		}
+		i.chunk = append(i.chunk, p[:free]...)
+		p = p[free:]
+
+		// 2. Hash complete chunks to leaf nodes
+		if len(i.chunk) == i.chunkSize {
+			i.leafNodeDigests = append(i.leafNodeDigests, leafHash(i.chunk))
+			i.chunk = i.chunk[:0]
+		}
+	}
+	return n, nil
+}
+
+// Sum appends the 32-byte tophash to b.
+func (i *InstanceHasher) Sum(b []byte) []byte {
+	topHashDigest := topHash(i.leaves())
+	return append(b, topHashDigest[:]...)
+}
+
+// Tree returns the Merkle tree of the data written so far.
+func (i *InstanceHasher) Tree() *MerkleTree {
+	return newMerkleTree(i.leaves())
+}
+
+// leaves returns the leaf node digests including the incomplete last chunk.
+func (i *InstanceHasher) leaves() [][32]byte {
+	leafNodeDigests := i.leafNodeDigests
+	if len(i.chunk) > 0 || len(leafNodeDigests) == 0 {
+		leafNodeDigests = append(leafNodeDigests[:len(leafNodeDigests):len(leafNodeDigests)], leafHash(i.chunk))
+	}
+	return leafNodeDigests
+}
+
+// Code returns the encoded Instance-ID and the hex encoded tophash.
+func (i *InstanceHasher) Code() (code string, hex_hash string) {
+	return instanceCode(topHash(i.leaves()))
+}
+
+func (i *InstanceHasher) Reset() {
+	i.chunk = i.chunk[:0]
+	i.leafNodeDigests = nil
+}
+
+func (i *InstanceHasher) Size() int {
+	return 32
+}
+
+func (i *InstanceHasher) BlockSize() int {
+	return i.chunkSize
+}
@@ -1,6 +1,7 @@
 package iscc
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
@@ -8,21 +9,36 @@ import (
 	"github.com/coblo/iscc-golang/packages/base58"
 	"github.com/coblo/iscc-golang/packages/cdc"
 	"github.com/coblo/iscc-golang/packages/hashes"
+	"github.com/coblo/iscc-golang/packages/htmltext"
+	"github.com/coblo/iscc-golang/packages/wav"
+	"github.com/coblo/iscc-golang/packages/y4m"
 	"github.com/pkg/errors"
 	"image"
+	_ "image/gif"
 	_ "image/jpeg"
 	_ "image/png"
 	"io"
+	"math"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type ISCC struct {
-	Meta     [11]byte
-	Partial  bool
-	Gmt      int
-	Content  [11]byte
-	Data     [11]byte
-	Instance [11]byte
+	Meta    [11]byte
+	Partial bool
+	Gmt     int
+	// PrivateHeader is the Content-ID header of private components, whose
+	// Gmt is GMT_PRIVATE.
+	PrivateHeader byte
+	Content       [11]byte
+	Data          [11]byte
+	Instance      [11]byte
+	// Profile names the generator profile the code was created with. It
+	// is empty if unknown, e.g. for parsed codes.
+	Profile string
 }
 
 const (
@@ -45,15 +61,22 @@ const (
 )
 
 func MetaId(title, extra string, version int) (metaId, processedTitle, processedExtra string, err error) {
+	return DefaultProfile.MetaId(title, extra, version)
+}
+
+func (p Profile) MetaId(title, extra string, version int) (metaId, processedTitle, processedExtra string, err error) {
+	if err = p.Validate(); err != nil {
+		return
+	}
 
 	// 1. verify version is supported
 	if version != 1 {
-		return "", "", "", errors.New("Only version 1 is supported")
+		return "", "", "", ErrUnsupportedVersion
 	}
 
 	// 2. & 3. Pre normalization & trimming
-	processedTitle = textTrim(textPreNormalize(title))
-	processedExtra = textTrim(textPreNormalize(extra))
+	processedTitle = textTrim(textPreNormalize(title), p.InputTrim)
+	processedExtra = textTrim(textPreNormalize(extra), p.InputTrim)
 
 	// 4. Concatenate
 	concat := strings.TrimSpace(processedTitle + "\u0020" + processedExtra)
@@ -62,7 +85,7 @@ func MetaId(title, extra string, version int) (metaId, processedTitle, processed
 	normalized := textNormalize(concat)
 
 	// 6. Create list of n-grams
-	nGramWindows, err := createNGramWindowsLetterWise(normalized, WINDOW_SIZE_MID)
+	nGramWindows, err := createNGramWindowsLetterWise(normalized, p.WindowSizeMid)
 	if err != nil {
 		return
 	}
@@ -92,6 +115,14 @@ func MetaId(title, extra string, version int) (metaId, processedTitle, processed
 }
 
 func ContentIdText(text string, partial bool) (string, error) {
+	return DefaultProfile.ContentIdText(text, partial)
+}
+
+func (p Profile) ContentIdText(text string, partial bool) (string, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+
 	// 1. & 2. Pre-normalize and normalize
 	text = textNormalize(textPreNormalize(text))
 
@@ -99,7 +130,7 @@ func ContentIdText(text string, partial bool) (string, error) {
 	w := strings.Split(text, " ")
 
 	// 4. create 5 word shingles
-	wordNGrams, err := createNGramWindowsWordWise(w, WINDOW_SIZE_CID_T)
+	wordNGrams, err := createNGramWindowsWordWise(w, p.WindowSizeCidT)
 	if err != nil {
 		return "", err
 	}
@@ -122,6 +153,9 @@ func ContentIdText(text string, partial bool) (string, error) {
 
 	// 9. Apply simhash to digests
 	simhashDigest, err := hashes.SimilarityHash(lsb)
+	if err != nil {
+		return "", err
+	}
 
 	// 10. & 11. prepend component header, encode and return
 	if partial {
@@ -131,9 +165,39 @@ func ContentIdText(text string, partial bool) (string, error) {
 	}
 }
 
+// ContentIdHTML creates the text Content-ID of the readable text of an
+// HTML document. It also returns the document title as a suggested title
+// for the Meta-ID.
+func ContentIdHTML(r io.Reader, partial bool) (contentId, title string, err error) {
+	return DefaultProfile.ContentIdHTML(r, partial)
+}
+
+func (p Profile) ContentIdHTML(r io.Reader, partial bool) (contentId, title string, err error) {
+	// 1. Extract text, blocks are separated by newlines
+	text, title, err := htmltext.Extract(r)
+	if err != nil {
+		return "", "", err
+	}
+
+	// 2. Create text Content-ID
+	contentId, err = p.ContentIdText(textJoinLines(text), partial)
+	return contentId, title, err
+}
+
 func ContentIdImage(img image.Image, partial bool) (contentId string, err error) {
+	return DefaultProfile.ContentIdImage(img, partial)
+}
+
+func (p Profile) ContentIdImage(img image.Image, partial bool) (contentId string, err error) {
+	if err = p.Validate(); err != nil {
+		return
+	}
+
 	// 1. Normalize image to 2-dimensional pixel array
-	grayImage, err := imageNormalize(img)
+	grayImage, err := imageNormalize(img, p.ImageSize)
+	if err != nil {
+		return
+	}
 
 	// 2. Calculate image hash
 	hashDigest := hashes.ImageHash(*grayImage)
@@ -152,14 +216,165 @@ func ContentIdImage(img image.Image, partial bool) (contentId string, err error)
 }
 
 func ContentIdImageFromFile(reader io.Reader, partial bool) (contentId string, err error) {
+	return DefaultProfile.ContentIdImageFromFile(reader, partial)
+}
+
+func (p Profile) ContentIdImageFromFile(reader io.Reader, partial bool) (contentId string, err error) {
+	if reader, err = nonEmpty(reader); err != nil {
+		return
+	}
 	img, _, err := image.Decode(reader)
 	if err != nil {
 		return
 	}
-	return ContentIdImage(img, partial)
+	return p.ContentIdImage(img, partial)
+}
+
+func ContentIdAudio(samples []float64, sampleRate int, partial bool) (string, error) {
+	return DefaultProfile.ContentIdAudio(samples, sampleRate, partial)
+}
+
+func (p Profile) ContentIdAudio(samples []float64, sampleRate int, partial bool) (string, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+	if sampleRate < hashes.CHROMA_MIN_SAMPLE_RATE || sampleRate > hashes.CHROMA_MAX_SAMPLE_RATE {
+		return "", errors.Wrapf(ErrInvalidSampleRate, "%d Hz outside of %d-%d Hz", sampleRate, hashes.CHROMA_MIN_SAMPLE_RATE, hashes.CHROMA_MAX_SAMPLE_RATE)
+	}
+
+	// 1. Normalize mono samples
+	samples = audioNormalize(samples)
+
+	// 2. Create 32-bit chroma features
+	features := hashes.ChromaFeatures(samples, sampleRate)
+	if len(features) == 0 {
+		return "", errors.Wrap(ErrEmptyInput, "Audio too short for a single frame")
+	}
+
+	// 3. Apply minimum-hash
+	mHash := hashes.MinHash(features)
+
+	// 4. & 5. Collect least significant bits and create 64-bit digests
+	lsb := getLSBDigests(mHash)
+
+	// 6. Apply simhash to digests
+	simhashDigest, err := hashes.SimilarityHash(lsb)
+	if err != nil {
+		return "", err
+	}
+
+	// 7. & 8. Prepend component header, encode and return
+	if partial {
+		return base58.Encode(append([]byte{HEAD_CID_A_PCF}, simhashDigest...))
+	} else {
+		return base58.Encode(append([]byte{HEAD_CID_A}, simhashDigest...))
+	}
+}
+
+func ContentIdAudioFromFile(reader io.Reader, partial bool) (contentId string, err error) {
+	return DefaultProfile.ContentIdAudioFromFile(reader, partial)
+}
+
+func (p Profile) ContentIdAudioFromFile(reader io.Reader, partial bool) (contentId string, err error) {
+	if reader, err = nonEmpty(reader); err != nil {
+		return
+	}
+	samples, sampleRate, err := wav.Decode(reader)
+	if err != nil {
+		return
+	}
+	return p.ContentIdAudio(samples, sampleRate, partial)
+}
+
+const VIDEO_SAMPLE_INTERVAL = time.Second
+
+// FrameReader provides decoded video frames with their presentation
+// timestamps. ReadFrame returns io.EOF after the last frame.
+type FrameReader interface {
+	ReadFrame() (image.Image, time.Duration, error)
+}
+
+func ContentIdVideo(frames FrameReader, partial bool) (string, error) {
+	return DefaultProfile.ContentIdVideo(frames, partial)
+}
+
+func (p Profile) ContentIdVideo(frames FrameReader, partial bool) (string, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+
+	var frameDigests [][]byte
+	nextSample := time.Duration(0)
+	exhausted := false
+	for {
+		img, timestamp, err := frames.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		// 1. Sample one frame per interval independent of the frame rate,
+		// no more frames once the next interval is out of range
+		if exhausted || timestamp < nextSample {
+			continue
+		}
+		start := timestamp - timestamp%p.VideoInterval
+		if start > math.MaxInt64-p.VideoInterval {
+			exhausted = true
+		} else {
+			nextSample = start + p.VideoInterval
+		}
+
+		// 2. Normalize frame and calculate image hash
+		grayImage, err := imageNormalize(img, p.ImageSize)
+		if err != nil {
+			return "", err
+		}
+		frameDigest := make([]byte, 8)
+		binary.BigEndian.PutUint64(frameDigest, hashes.ImageHash(*grayImage))
+		frameDigests = append(frameDigests, frameDigest)
+	}
+	if len(frameDigests) == 0 {
+		return "", errors.Wrap(ErrEmptyInput, "Video contains no frames")
+	}
+
+	// 3. Apply simhash to frame digests
+	simhashDigest, err := hashes.SimilarityHash(frameDigests)
+	if err != nil {
+		return "", err
+	}
+
+	// 4. & 5. Prepend component header, encode and return
+	if partial {
+		return base58.Encode(append([]byte{HEAD_CID_V_PCF}, simhashDigest...))
+	} else {
+		return base58.Encode(append([]byte{HEAD_CID_V}, simhashDigest...))
+	}
+}
+
+// ContentIdVideoFromFile reads frames from a YUV4MPEG2 stream.
+func ContentIdVideoFromFile(reader io.Reader, partial bool) (contentId string, err error) {
+	return DefaultProfile.ContentIdVideoFromFile(reader, partial)
+}
+
+func (p Profile) ContentIdVideoFromFile(reader io.Reader, partial bool) (contentId string, err error) {
+	if reader, err = nonEmpty(reader); err != nil {
+		return
+	}
+	frames, err := y4m.NewReader(reader)
+	if err != nil {
+		return
+	}
+	return p.ContentIdVideo(frames, partial)
 }
 
 func ContentIdMixed(cids []string, partial bool) (string, error) {
+	return DefaultProfile.ContentIdMixed(cids, partial)
+}
+
+func (p Profile) ContentIdMixed(cids []string, partial bool) (string, error) {
 	// 1. Decode CIDs
 	decoded := make([][]byte, len(cids))
 	var err error
@@ -171,7 +386,13 @@ func ContentIdMixed(cids []string, partial bool) (string, error) {
 	}
 
 	// 2. Extract first 8-bytes
+	if len(decoded) == 0 {
+		return "", errors.Wrap(ErrEmptyInput, "No Content-IDs to combine")
+	}
 	for i := range decoded {
+		if err := verifyHeader(cids[i], HEAD_CID_T, HEAD_CID_M_PCF); err != nil {
+			return "", errors.Wrapf(err, "Content-ID %d", i)
+		}
 		decoded[i] = decoded[i][:8]
 	}
 
@@ -190,8 +411,19 @@ func ContentIdMixed(cids []string, partial bool) (string, error) {
 }
 
 func DataId(r io.Reader) (string, error) {
+	return DefaultProfile.DataId(r)
+}
+
+func (p Profile) DataId(r io.Reader) (string, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+
 	// 1 & 2. xxHash32 over CDC
-	features := cdc.GetHashedCDC(r)
+	features, err := cdc.GetHashedCDCWithParams(r, p.Chunking)
+	if err != nil {
+		return "", err
+	}
 
 	// 3. Apply minimum hash
 	mhash := hashes.MinHash(features)
@@ -212,35 +444,111 @@ func DataId(r io.Reader) (string, error) {
 	return base58.Encode(data_id_digest)
 }
 
-func InstanceId(r io.Reader) (code string, hex_hash string) {
-	buffer := make([]byte, 64000)
+func InstanceId(r io.Reader) (code string, hex_hash string, err error) {
+	return DefaultProfile.InstanceId(r)
+}
 
-	var leafNodeDigests [][32]byte
-	// 1. Split int 64 kB chunks
-	for {
-		n, _ := r.Read(buffer)
-		if n == 0 {
-			break
-		}
-		// 2. for each chunk calc sha256d  of the concatenation of a 0x00 byte and the chunk
-		leafNodeDigests = append(leafNodeDigests, doubleSha256(append([]byte{'\x00'}, buffer[:n]...)))
-	}
-	// 3. & 4. Apply topHash
-	topHashDigest := topHash(leafNodeDigests)
-
-	// 5. & 6. Trim the tophash to the first 8 bytes and prepend component header
-	instanceIdDigest := append([]byte{HEAD_IID}, topHashDigest[:8]...)
-	// 7. encode instance id
-	code, _ = base58.Encode(instanceIdDigest)
-	// 8. Hex encode the tophash
-	hex_hash = hex.EncodeToString(topHashDigest[:])
-	// 9. return the instance id and the hex encoded tophash
+func (p Profile) InstanceId(r io.Reader) (code string, hex_hash string, err error) {
+	// 1. & 2. Split into 64 kB chunks and calculate the leaf node hashes
+	hasher, err := p.NewInstanceHasher()
+	if err != nil {
+		return
+	}
+	if _, err = io.Copy(hasher, r); err != nil {
+		return "", "", err
+	}
+
+	// 3. - 9. Apply topHash, encode and return the instance id and the hex encoded tophash
+	code, hex_hash = hasher.Code()
 	return
 }
 
+// InstanceIdReaderAt calculates the same Instance-ID and tophash as
+// InstanceId while hashing the chunks of size bytes of r with concurrent
+// workers. A worker count below 1 uses one worker per CPU.
+func InstanceIdReaderAt(r io.ReaderAt, size int64, workers int) (code string, hex_hash string, err error) {
+	return DefaultProfile.InstanceIdReaderAt(r, size, workers)
+}
+
+func (p Profile) InstanceIdReaderAt(r io.ReaderAt, size int64, workers int) (code string, hex_hash string, err error) {
+	if err = p.Validate(); err != nil {
+		return
+	}
+	if size < 0 {
+		return "", "", errors.Wrapf(ErrInvalidSize, "%d", size)
+	}
+	chunkSize := int64(p.InstanceChunkSize)
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	// 1. Number of 64 kB chunks, an empty stream has a single empty chunk
+	leaves := int((size + chunkSize - 1) / chunkSize)
+	if leaves == 0 {
+		leaves = 1
+	}
+
+	// 2. Hash chunks to leaf nodes concurrently
+	leafNodeDigests := make([][32]byte, leaves)
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		next  int64 = -1
+		ioErr error
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buffer := make([]byte, chunkSize)
+			for {
+				i := atomic.AddInt64(&next, 1)
+				if i >= int64(leaves) {
+					return
+				}
+				offset := i * chunkSize
+				chunk := buffer
+				if size-offset < chunkSize {
+					chunk = buffer[:size-offset]
+				}
+				n, err := r.ReadAt(chunk, offset)
+				if n < len(chunk) {
+					if err == nil || err == io.EOF {
+						err = io.ErrUnexpectedEOF
+					}
+					mu.Lock()
+					if ioErr == nil {
+						ioErr = err
+					}
+					mu.Unlock()
+					// skip the remaining chunks
+					atomic.StoreInt64(&next, int64(leaves))
+					return
+				}
+				leafNodeDigests[i] = leafHash(chunk)
+			}
+		}()
+	}
+	wg.Wait()
+	if ioErr != nil {
+		return "", "", ioErr
+	}
+
+	// 3. - 9. Apply topHash, encode and return
+	code, hex_hash = instanceCode(topHash(leafNodeDigests))
+	return
+}
+
+// instanceCode encodes the Instance-ID from the first 8 bytes of the tophash
+// and hex encodes the tophash.
+func instanceCode(topHashDigest [32]byte) (code string, hex_hash string) {
+	code, _ = base58.Encode(append([]byte{HEAD_IID}, topHashDigest[:8]...))
+	return code, hex.EncodeToString(topHashDigest[:])
+}
+
 func createNGramWindowsLetterWise(text string, width int) ([][]byte, error) {
 	if width < 2 {
-		return nil, errors.New("Sliding window width must be 2 or bigger")
+		return nil, ErrInvalidWindowWidth
 	}
 	chars := []rune(text)
 
@@ -259,7 +567,7 @@ func createNGramWindowsLetterWise(text string, width int) ([][]byte, error) {
 // TODO build interface to combine those 2 methods
 func createNGramWindowsWordWise(words []string, width int) ([][]string, error) {
 	if width < 2 {
-		return nil, errors.New("Sliding window width must be 2 or bigger")
+		return nil, ErrInvalidWindowWidth
 	}
 
 	// if the window width exceeds the string length use only one ngram
@@ -274,12 +582,30 @@ func createNGramWindowsWordWise(words []string, width int) ([][]string, error) {
 	return windows, nil
 }
 
+// nonEmpty returns a reader equal to r or ErrEmptyInput if r has no data.
+func nonEmpty(r io.Reader) (io.Reader, error) {
+	first := make([]byte, 1)
+	n, err := io.ReadFull(r, first)
+	if n == 0 {
+		if err == io.EOF {
+			return nil, errors.Wrap(ErrEmptyInput, "Zero-byte file")
+		}
+		return nil, err
+	}
+	return io.MultiReader(bytes.NewReader(first), r), nil
+}
+
 func doubleSha256(data []byte) (res [32]byte) {
 	res = sha256.Sum256(data)
 	return sha256.Sum256(res[:])
 
 }
 
+// leafHash calculates sha256d of the concatenation of a 0x00 byte and the chunk.
+func leafHash(chunk []byte) [32]byte {
+	return doubleSha256(append([]byte{'\x00'}, chunk...))
+}
+
 func topHash(hashes [][32]byte) [32]byte {
 	size := len(hashes)
 	if len(hashes) == 1 {
@@ -287,7 +613,7 @@ func topHash(hashes [][32]byte) [32]byte {
 	}
 
 	pairwiseHashed := make([][32]byte, (size/2 + (size % 2)))
-	for i := range pairwiseHashed {
+	for i := 0; i < size/2; i++ {
 		pairwiseHashed[i] = hashInnerNodes(hashes[i*2], hashes[(i*2)+1])
 	}
 	if size%2 == 1 {
@@ -1,12 +1,33 @@
 package iscc
 
 import (
+	"archive/zip"
 	"bytes"
+	"context"
 	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/coblo/iscc-golang/packages/base58"
+	"github.com/coblo/iscc-golang/packages/cdc"
+	"github.com/coblo/iscc-golang/packages/epub"
 	"github.com/coblo/iscc-golang/packages/hashes"
+	"github.com/coblo/iscc-golang/packages/htmltext"
+	"github.com/coblo/iscc-golang/packages/index"
+	"github.com/coblo/iscc-golang/packages/office"
+	"github.com/coblo/iscc-golang/packages/y4m"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 const (
@@ -22,7 +43,10 @@ func TestMetaId(t *testing.T) {
 
 func TestInstanceId(t *testing.T) {
 	zeroBytesEven := make([]byte, 16)
-	iid, h := InstanceId(bytes.NewReader(zeroBytesEven))
+	iid, h, err := InstanceId(bytes.NewReader(zeroBytesEven))
+	if err != nil {
+		t.Error(err)
+	}
 	expected := "CR8UZLfpaCm1d"
 	if iid != expected {
 		t.Logf("Expected '%s', got '%s'", expected, iid)
@@ -38,7 +62,7 @@ func TestInstanceId(t *testing.T) {
 	for i := range ffBytesUneven {
 		ffBytesUneven[i] = '\xff'
 	}
-	iid, h = InstanceId(bytes.NewReader(ffBytesUneven))
+	iid, h, _ = InstanceId(bytes.NewReader(ffBytesUneven))
 	expected = "CR6Nh6fvCxHj9"
 	if iid != expected {
 		t.Logf("Expected '%s', got '%s'", expected, iid)
@@ -54,7 +78,7 @@ func TestInstanceId(t *testing.T) {
 	for i := range moreBytes {
 		moreBytes[i] = '\xcc'
 	}
-	iid, h = InstanceId(bytes.NewReader(moreBytes))
+	iid, h, _ = InstanceId(bytes.NewReader(moreBytes))
 
 	expected = "CRdhBqWwY7u7i"
 	if iid != expected {
@@ -71,12 +95,12 @@ func TestInstanceId(t *testing.T) {
 }
 
 func TestTextTrim(t *testing.T) {
-	trimmed := textTrim(strings.Repeat("ü", 128))
+	trimmed := textTrim(strings.Repeat("ü", 128), INPUT_TRIM)
 	if len(trimmed) != 128 {
 		t.Fail()
 	}
 
-	trimmed = textTrim(strings.Repeat("驩", 128))
+	trimmed = textTrim(strings.Repeat("驩", 128), INPUT_TRIM)
 	if len(trimmed) != 126 {
 		t.Fail()
 	}
@@ -111,7 +135,56 @@ func TestDataId(t *testing.T) {
 	//}
 }
 func TestEncode(t *testing.T) {
+	// 1. Component encoding is unchanged
+	mid, _, _, _ := MetaId("ISCC Content Identifiers", "", 1)
+	digest, err := base58.Decode(mid)
+	if err != nil || len(digest) != 9 {
+		t.Fatal(digest, err)
+	}
+	for _, part := range [][]byte{digest, digest[:1], digest[1:]} {
+		encoded, err := base58.Encode(part)
+		if err != nil || !strings.Contains(mid, encoded) {
+			t.Errorf("Encode(%x) = %s, %v", part, encoded, err)
+		}
+	}
+
+	// 2. Arbitrary lengths round trip
+	for _, n := range []int{1, 2, 8, 16, 17, 32, 33, 36} {
+		data := bytes.Repeat([]byte{maxByte}, n)
+		encoded, err := base58.Encode(data)
+		if err != nil {
+			t.Errorf("Encode %d bytes: %s, %v", n, encoded, err)
+		}
+		decoded, err := base58.Decode(encoded)
+		if err != nil || !bytes.Equal(decoded, data) {
+			t.Errorf("Decode %s = %x, %v", encoded, decoded, err)
+		}
+	}
+
+	// 3. Block lengths are derived directly from the code length
+	for n := 1; n <= 300; n++ {
+		data := bytes.Repeat([]byte{maxByte}, n)
+		if decoded, err := base58.DecodeBlock(base58.EncodeBlock(data)); err != nil || !bytes.Equal(decoded, data) {
+			t.Errorf("DecodeBlock of %d bytes = %x, %v", n, decoded, err)
+		}
+	}
+	if _, err := base58.Decode(strings.Repeat("z", 20001)); !errors.Is(err, base58.ErrInvalidCodeLength) {
+		t.Errorf("Expected invalid length for long code, got %v", err)
+	}
 
+	// 4. Invalid input is rejected
+	var charErr *base58.InvalidCharacterError
+	if _, err := base58.Decode("CCDFPFc87MhdI"); !errors.As(err, &charErr) || charErr.Position != 12 {
+		t.Errorf("Expected invalid character at position 12, got %v", err)
+	}
+	for _, code := range []string{"", "CCDF", "zz", "CCDFPFc87Mhd"} {
+		if _, err := base58.Decode(code); err == nil {
+			t.Errorf("Expected error decoding %q", code)
+		}
+	}
+	if _, err := base58.Encode(make([]byte, 19)); err == nil {
+		t.Error("Expected error for block ambiguous with components")
+	}
 }
 
 func TestContentIdMixed(t *testing.T) {
@@ -425,3 +498,1495 @@ func TestContentIdImage(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestParseISCC(t *testing.T) {
+	mid, _, _, _ := MetaId("ISCC Content Identifiers", "", 1)
+	cid, _ := ContentIdText("", true)
+	did := "CD86h6EiEUiJW"
+	iid := "CR8UZLfpaCm1d"
+
+	code, err := NewISCC(mid, cid, did, iid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !code.Partial || code.Gmt != GMT_TEXT {
+		t.Fail()
+	}
+	expected := mid + "-" + cid + "-" + did + "-" + iid
+	if code.String() != expected {
+		t.Logf("Expected '%s', got '%s'", expected, code.String())
+		t.Fail()
+	}
+
+	parsed, err := ParseISCC(mid + cid + did + iid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed != code {
+		t.Fail()
+	}
+	if parsed.ContentId() != cid || parsed.InstanceId() != iid {
+		t.Fail()
+	}
+
+	parsed, err = ParseISCC(code.String())
+	if err != nil || parsed != code {
+		t.Fail()
+	}
+
+	// Content-ID in place of Meta-ID
+	if _, err := ParseISCC(cid + cid + did + iid); err == nil {
+		t.Fail()
+	}
+	if _, err := ParseISCC(mid + cid + did); err == nil {
+		t.Fail()
+	}
+}
+
+func TestDistance(t *testing.T) {
+	d, err := Distance("CTiesaXaMqbbU", "CtiesaXaMqbbU")
+	if err != nil || d != 0 {
+		t.Fail()
+	}
+
+	textA, _ := ContentIdText("The quick brown fox jumps over the lazy dog", false)
+	textB, _ := ContentIdText("The quick brown fox jumps over the lazy cat", false)
+	d, err = Distance(textA, textB)
+	if err != nil {
+		t.Error(err)
+	}
+	if d <= 0 || d > COMPONENT_BITS {
+		t.Logf("Unexpected distance %d", d)
+		t.Fail()
+	}
+
+	img, _ := os.Open("testfiles/cat.jpg")
+	defer img.Close()
+	cidImage, err := ContentIdImageFromFile(img, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Distance(textA, cidImage); err == nil {
+		t.Fail()
+	}
+}
+
+func TestCompare(t *testing.T) {
+	a, err := ParseISCC("CCDFPFc87MhdT-CTiesaXaMqbbU-CD86h6EiEUiJW-CR8UZLfpaCm1d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := Compare(a, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.IdenticalInstance || c.Similarity != 1 || c.Meta != 0 {
+		t.Fail()
+	}
+
+	b, err := ParseISCC("CCDFPFc87MhdT-CTiesaXaMqbbU-CD86h6EiEUiJW-CR6Nh6fvCxHj9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err = Compare(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.IdenticalInstance || c.Similarity != 1 {
+		t.Fail()
+	}
+
+	// different Content-ID types are not comparable, the other components are
+	b.Gmt = GMT_IMAGE
+	c, err = Compare(a, b)
+	if err != nil || c.Content != -1 || c.Meta != 0 || c.Data != 0 || c.IdenticalInstance || c.Similarity != 1 {
+		t.Errorf("Unexpected comparison %+v, %v", c, err)
+	}
+	if _, err := Distance(a.ContentId(), b.ContentId()); !errors.Is(err, ErrUnknownHeader) {
+		t.Errorf("Expected header error, got %v", err)
+	}
+}
+
+func TestContentIdAudio(t *testing.T) {
+	sampleRate := 22050
+	// A major chord followed by a C major chord
+	chord := func(amplitude float64, noise float64) []float64 {
+		rnd := uint32(1)
+		samples := make([]float64, 3*sampleRate)
+		for i := range samples {
+			t := float64(i) / float64(sampleRate)
+			freqs := []float64{440.0, 554.37, 659.25}
+			if i > sampleRate {
+				freqs = []float64{523.25, 659.25, 783.99}
+			}
+			for j, freq := range freqs {
+				samples[i] += amplitude * (1 - 0.25*float64(j)) * math.Sin(2*math.Pi*freq*t)
+			}
+			rnd = rnd*1664525 + 1013904223
+			samples[i] += noise * (float64(rnd)/(1<<31) - 1)
+		}
+		return samples
+	}
+
+	cidA, err := ContentIdAudio(chord(0.8, 0), sampleRate, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cidA) != 13 || cidA[:2] != "CA" {
+		t.Logf("Unexpected Content-ID '%s'", cidA)
+		t.Fail()
+	}
+
+	// amplitude does not change the code
+	cidQuiet, _ := ContentIdAudio(chord(0.2, 0), sampleRate, false)
+	if cidQuiet != cidA {
+		t.Logf("Expected '%s', got '%s'", cidA, cidQuiet)
+		t.Fail()
+	}
+
+	cidNoisy, _ := ContentIdAudio(chord(0.8, 0.05), sampleRate, true)
+	d, err := Distance(cidA, cidNoisy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d > 16 {
+		t.Logf("Distance %d too large", d)
+		t.Fail()
+	}
+
+	// 16-bit stereo WAV of the same signal
+	samples := chord(0.8, 0)
+	var wav bytes.Buffer
+	le := binary.LittleEndian
+	wav.WriteString("RIFF")
+	binary.Write(&wav, le, uint32(36+len(samples)*4))
+	wav.WriteString("WAVEfmt ")
+	binary.Write(&wav, le, []uint32{16})
+	binary.Write(&wav, le, []uint16{1, 2})
+	binary.Write(&wav, le, []uint32{uint32(sampleRate), uint32(sampleRate * 4)})
+	binary.Write(&wav, le, []uint16{4, 16})
+	wav.WriteString("data")
+	binary.Write(&wav, le, uint32(len(samples)*4))
+	for _, s := range samples {
+		binary.Write(&wav, le, []int16{int16(s * 16383), int16(s * 16383)})
+	}
+	cidWav, err := ContentIdAudioFromFile(&wav, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, _ = Distance(cidA, cidWav)
+	if d > 4 {
+		t.Logf("Distance %d too large", d)
+		t.Fail()
+	}
+
+	if _, err := ContentIdAudioFromFile(strings.NewReader("RIFF"), false); err == nil {
+		t.Fail()
+	}
+
+	// sample rates out of range and oversized fmt chunks are rejected
+	for _, rate := range []int{1, 4000000000} {
+		if _, err := ContentIdAudio(samples, rate, false); !errors.Is(err, ErrInvalidSampleRate) {
+			t.Logf("Sample rate %d accepted", rate)
+			t.Fail()
+		}
+	}
+	invalid := DefaultProfile
+	invalid.InputTrim = 0
+	if _, err := invalid.ContentIdAudio(samples, sampleRate, false); err == nil {
+		t.Error("Expected error for invalid profile")
+	}
+	oversized := []byte("RIFF\x00\x00\x00\x00WAVEfmt \xff\xff\xff\xff")
+	if _, err := ContentIdAudioFromFile(bytes.NewReader(oversized), false); err == nil {
+		t.Fail()
+	}
+}
+
+func TestContentIdVideo(t *testing.T) {
+	reader, _ := os.Open("testfiles/lenna.jpg")
+	defer reader.Close()
+	img, _, err := image.Decode(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gray := image.NewGray(img.Bounds())
+	draw.Draw(gray, gray.Bounds(), img, image.Point{}, draw.Src)
+
+	// mono YUV4MPEG2 stream of identical frames
+	stream := func(fps, seconds int) *bytes.Buffer {
+		var buf bytes.Buffer
+		w, h := gray.Bounds().Dx(), gray.Bounds().Dy()
+		buf.WriteString(fmt.Sprintf("YUV4MPEG2 W%d H%d F%d:1 Ip A1:1 Cmono\n", w, h, fps))
+		for i := 0; i < fps*seconds; i++ {
+			buf.WriteString("FRAME\n")
+			buf.Write(gray.Pix)
+		}
+		return &buf
+	}
+
+	cidV, err := ContentIdVideoFromFile(stream(5, 2), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cidI, _ := ContentIdImage(gray, false)
+	if cidV[:2] != "CV" || cidV[2:] != cidI[2:] {
+		t.Logf("Expected body of '%s', got '%s'", cidI, cidV)
+		t.Fail()
+	}
+
+	cidV2, err := ContentIdVideoFromFile(stream(2, 2), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cidV2[:2] != "Cv" || cidV2[2:] != cidV[2:] {
+		t.Fail()
+	}
+
+	if _, err := ContentIdVideoFromFile(stream(5, 0), false); err == nil {
+		t.Fail()
+	}
+	if _, err := ContentIdVideoFromFile(strings.NewReader("YUV4MPEG2 W10\n"), false); err == nil {
+		t.Fail()
+	}
+
+	// timestamps of high frame rates do not overflow
+	frames, err := y4m.NewReader(strings.NewReader("YUV4MPEG2 W1 H1 F1000000000:1 Cmono\n" + strings.Repeat("FRAME\n\x80", 12)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 12; i++ {
+		if _, timestamp, err := frames.ReadFrame(); err != nil || timestamp != time.Duration(i) {
+			t.Fatalf("Frame %d at %v, %v", i, timestamp, err)
+		}
+	}
+	frames, _ = y4m.NewReader(strings.NewReader("YUV4MPEG2 W1 H1 F1:1000000000 Cmono\n" + strings.Repeat("FRAME\n\x80", 12)))
+	for i := 0; i < 12; i++ {
+		if _, _, err = frames.ReadFrame(); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		t.Error("Expected error for timestamps out of range")
+	}
+
+	// sampling of huge frame durations takes one step per frame
+	slow := "YUV4MPEG2 W2 H2 F1:9223372036 Cmono\n" + strings.Repeat("FRAME\n\x80\x80\x80\x80", 2)
+	if _, err := ContentIdVideoFromFile(strings.NewReader(slow), false); err != nil {
+		t.Error(err)
+	}
+	fine := DefaultProfile
+	fine.VideoInterval = time.Nanosecond
+	slow = "YUV4MPEG2 W2 H2 F1:9000000000 Cmono\n" + strings.Repeat("FRAME\n\x80\x80\x80\x80", 2)
+	if _, err := fine.ContentIdVideoFromFile(strings.NewReader(slow), false); err != nil {
+		t.Error(err)
+	}
+
+	// header lines are bounded
+	if _, err := ContentIdVideoFromFile(strings.NewReader("YUV4MPEG2 "+strings.Repeat("X", y4m.MAX_HEADER_LENGTH)), false); err == nil {
+		t.Error("Expected error for unterminated stream header")
+	}
+	long := "YUV4MPEG2 W1 H1 Cmono\nFRAME" + strings.Repeat(" X", y4m.MAX_HEADER_LENGTH)
+	if _, err := ContentIdVideoFromFile(strings.NewReader(long), false); err == nil {
+		t.Error("Expected error for unterminated frame header")
+	}
+}
+
+func TestIndex(t *testing.T) {
+	idx := index.New()
+	texts := []string{
+		"The quick brown fox jumps over the lazy dog",
+		"The quick brown fox jumps over the lazy cat",
+		"Lorem ipsum dolor sit amet, consectetur adipiscing elit",
+	}
+	cids := make([]string, len(texts))
+	for i, text := range texts {
+		cids[i], _ = ContentIdText(text, false)
+		iid, _, _ := InstanceId(strings.NewReader(text))
+		if err := idx.Add(fmt.Sprintf("doc%d", i), cids[i], iid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := idx.Add("img", "CYDfTq7Qc7Fre"); err != nil {
+		t.Fatal(err)
+	}
+
+	nearest, err := idx.Nearest(cids[0], 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nearest) != 2 || nearest[0].ID != "doc0" || nearest[0].Distance != 0 || nearest[1].ID != "doc1" {
+		t.Logf("Unexpected matches %v", nearest)
+		t.Fail()
+	}
+
+	// image Content-IDs are not matched by text Content-IDs
+	within, err := idx.Within(cids[0], 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(within) != 3 {
+		t.Logf("Unexpected matches %v", within)
+		t.Fail()
+	}
+
+	iid, _, _ := InstanceId(strings.NewReader(texts[2]))
+	ids, err := idx.Lookup(iid)
+	if err != nil || len(ids) != 1 || ids[0] != "doc2" {
+		t.Fail()
+	}
+
+	idx.Remove("doc0")
+	nearest, _ = idx.Nearest(cids[0], 1)
+	if len(nearest) != 1 || nearest[0].ID != "doc1" {
+		t.Logf("Unexpected matches %v", nearest)
+		t.Fail()
+	}
+	if idx.Len() != 3 {
+		t.Fail()
+	}
+
+	if err := idx.Add("bad", "CCDFPFc87Mhd"); err == nil {
+		t.Fail()
+	}
+}
+
+func TestIndexStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := index.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Add("a", "CCDFPFc87MhdT", "CTiesaXaMqbbU", "CR8UZLfpaCm1d")
+	store.Add("b", "CD86h6EiEUiJW", "CR6Nh6fvCxHj9")
+	store.Add("c", "CYDfTq7Qc7Fre")
+	store.Remove("c")
+	store.Close()
+
+	// reload from log
+	store, err = index.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Len() != 2 || len(store.Entries("a")) != 3 {
+		t.Fail()
+	}
+	if err := store.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	store.Add("d", "CYDfTq7Qc7Fre")
+	store.Close()
+
+	// torn record at the end of the log
+	logs, _ := filepath.Glob(filepath.Join(dir, "log.*"))
+	if len(logs) != 1 {
+		t.Fatalf("Expected one log, got %v", logs)
+	}
+	f, _ := os.OpenFile(logs[0], os.O_WRONLY|os.O_APPEND, 0644)
+	f.Write([]byte{1, 0, 5, 'e'})
+	f.Close()
+
+	// reload from snapshot and log
+	store, err = index.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if store.Len() != 3 {
+		t.Logf("Expected 3 IDs, got %d", store.Len())
+		t.Fail()
+	}
+	ids, _ := store.Lookup("CR6Nh6fvCxHj9")
+	if len(ids) != 1 || ids[0] != "b" {
+		t.Fail()
+	}
+	matches, _ := store.Nearest("CYDfTq7Qc7Fre", 1)
+	if len(matches) != 1 || matches[0].ID != "d" {
+		t.Fail()
+	}
+	if err := store.Add("e", "CYDfTq7Qc7Fre"); err != nil {
+		t.Fatal(err)
+	}
+
+	// changes to IDs of the mapped snapshot survive the next snapshot
+	store.Remove("a")
+	store.Add("b", "CCDFPFc87MhdT")
+	if store.Len() != 3 || len(store.Entries("a")) != 0 || len(store.Entries("b")) != 3 {
+		t.Fail()
+	}
+	if err := store.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	store, err = index.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Len() != 3 || len(store.Entries("b")) != 3 {
+		t.Fail()
+	}
+	store.Add("f", "CYDfTq7Qc7Fre")
+	store.Add("g", "CYDfTq7Qc7Fre")
+	store.Close()
+
+	// corruption before the last record is an error
+	logs, _ = filepath.Glob(filepath.Join(dir, "log.*"))
+	data, _ := os.ReadFile(logs[0])
+	data[3] ^= 0xff
+	os.WriteFile(logs[0], data, 0644)
+	if _, err := index.Open(dir); err == nil {
+		t.Error("Expected error for corrupt log record")
+	}
+
+	// corruption of a record length or body before the end is an error and
+	// keeps the log intact
+	for _, field := range []string{"length", "ID length"} {
+		dir := t.TempDir()
+		store, err := index.Open(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range []string{"a", "b", "c", "d", "e"} {
+			store.Add(id, "CYDfTq7Qc7Fre")
+		}
+		store.Close()
+		logs, _ := filepath.Glob(filepath.Join(dir, "log.*"))
+		data, _ := os.ReadFile(logs[0])
+		size := len(data) / 5
+		if field == "length" {
+			data[size+3] ^= 0xff
+		} else {
+			data[size+10] ^= 0xff
+		}
+		os.WriteFile(logs[0], data, 0644)
+		if _, err := index.Open(dir); err == nil {
+			t.Errorf("Expected error for corrupt %s", field)
+		}
+		if info, _ := os.Stat(logs[0]); info.Size() != int64(len(data)) {
+			t.Errorf("Log truncated to %d bytes for corrupt %s", info.Size(), field)
+		}
+	}
+}
+
+func TestIndexStoreClosed(t *testing.T) {
+	dir := t.TempDir()
+	store, err := index.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Add("a", "CCDFPFc87MhdT", "CR8UZLfpaCm1d")
+	if err := store.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// queries after Close must not touch the unmapped snapshot
+	store, err = index.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches, _ := store.Within("CCDFPFc87MhdT", 5)
+	if len(matches) != 1 {
+		t.Fatalf("Expected one match, got %v", matches)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if matches[0].ID != "a" {
+		t.Fail()
+	}
+	if _, err := store.Within("CCDFPFc87MhdT", 5); !errors.Is(err, index.ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+	if _, err := store.Nearest("CCDFPFc87MhdT", 1); !errors.Is(err, index.ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+	if _, err := store.Lookup("CR8UZLfpaCm1d"); !errors.Is(err, index.ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+	if err := store.Add("b", "CCDFPFc87MhdT"); !errors.Is(err, index.ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+	if store.Len() != 0 || store.Entries("a") != nil {
+		t.Fail()
+	}
+	if err := store.Close(); !errors.Is(err, index.ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+}
+
+func TestComponentName(t *testing.T) {
+	if ComponentName(HEAD_CID_I_PCF) != "Content-ID Image" || !IsPartial(HEAD_CID_I_PCF) {
+		t.Fail()
+	}
+	if ComponentName(HEAD_IID) != "Instance-ID" || IsPartial(HEAD_IID) {
+		t.Fail()
+	}
+	if ComponentName(0x40) != "Unknown" {
+		t.Fail()
+	}
+}
+
+func TestGenerateFromReader(t *testing.T) {
+	for _, path := range []string{"testfiles/cat.jpg", "testfiles/cat.png", "README.md"} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, tophash, err := GenerateFromReader(bytes.NewReader(data), GenerateOptions{Title: "Cat"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mid, _, _, _ := MetaId("Cat", "", 1)
+		did, _ := DataId(bytes.NewReader(data))
+		iid, h, _ := InstanceId(bytes.NewReader(data))
+		if code.MetaId() != mid || code.DataId() != did || code.InstanceId() != iid || tophash != h {
+			t.Logf("%s: unexpected code %s", path, code)
+			t.Fail()
+		}
+		var cid string
+		if strings.HasSuffix(path, ".md") {
+			cid, _ = ContentIdText(string(data), false)
+		} else {
+			cid, _ = ContentIdImageFromFile(bytes.NewReader(data), false)
+		}
+		if code.ContentId() != cid {
+			t.Logf("%s: expected Content-ID '%s', got '%s'", path, cid, code.ContentId())
+			t.Fail()
+		}
+	}
+
+	data := make([]byte, 1000000)
+	for i := range data {
+		data[i] = byte(i % 256)
+	}
+	code, _, err := GenerateFromReader(bytes.NewReader(data), GenerateOptions{ContentId: "CTiesaXaMqbbU"})
+	if err != nil || code.ContentId() != "CTiesaXaMqbbU" || code.DataId() != "CD86h6EiEUiJW" {
+		t.Fail()
+	}
+
+	// unsupported media yield a code without Content-ID
+	code, tophash, err := GenerateFromReader(bytes.NewReader([]byte{0, 1, 2}), GenerateOptions{})
+	if err != nil || code.HasContent() || code.ContentId() != "" || tophash == "" {
+		t.Fatal(code, err)
+	}
+	parsed, err := ParseISCC(code.String())
+	if err != nil || parsed.String() != code.String() || strings.Count(code.String(), CODE_SEPARATOR) != 2 {
+		t.Errorf("Round trip of %s failed: %v", code, err)
+	}
+	withContent, _ := ParseISCC(code.MetaId() + "-CTiesaXaMqbbU-" + code.DataId() + "-" + code.InstanceId())
+	if c, err := Compare(code, withContent); err != nil || c.Content != -1 || c.Similarity != 1 {
+		t.Error(c, err)
+	}
+
+	// errors return zero values
+	code, tophash, err = GenerateFromReader(bytes.NewReader(data), GenerateOptions{ContentId: "CCDFPFc87MhdT"})
+	if err == nil || code != (ISCC{}) || tophash != "" {
+		t.Error(code, tophash, err)
+	}
+
+	// metadata suggested by documents, then the default title
+	page := "<html><head><title>Page Title</title></head><body><p>Some text</p></body></html>"
+	opts := GenerateOptions{SuggestedMetadata: true, DefaultTitle: "page"}
+	generated, err := Generate(strings.NewReader(page), opts)
+	mid, _, _, _ := MetaId("Page Title", "", 1)
+	if err != nil || generated.Title != "Page Title" || generated.MetaId() != mid || generated.Gmt != GMT_TEXT {
+		t.Error(generated, err)
+	}
+	opts.Title = "Given"
+	generated, _ = Generate(strings.NewReader(page), opts)
+	if mid, _, _, _ := MetaId("Given", "", 1); generated.Title != "Given" || generated.MetaId() != mid {
+		t.Error(generated)
+	}
+	generated, _ = Generate(bytes.NewReader(data), GenerateOptions{SuggestedMetadata: true, DefaultTitle: "page"})
+	if mid, _, _, _ := MetaId("page", "", 1); generated.Title != "page" || generated.MetaId() != mid {
+		t.Error(generated)
+	}
+}
+
+func TestHashers(t *testing.T) {
+	data := make([]byte, 1000000)
+	for i := range data {
+		data[i] = byte(i % 256)
+	}
+
+	dataHasher := NewDataHasher()
+	instanceHasher := NewInstanceHasher()
+	w := io.MultiWriter(dataHasher, instanceHasher)
+	for offset := 0; offset < len(data); offset += 777 {
+		end := offset + 777
+		if end > len(data) {
+			end = len(data)
+		}
+		w.Write(data[offset:end])
+	}
+
+	did, err := dataHasher.Code()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if did != "CD86h6EiEUiJW" {
+		t.Logf("Expected '%s', got '%s'", "CD86h6EiEUiJW", did)
+		t.Fail()
+	}
+
+	expectedIid, expectedHash, _ := InstanceId(bytes.NewReader(data))
+	iid, h := instanceHasher.Code()
+	if iid != expectedIid || h != expectedHash {
+		t.Logf("Expected '%s', got '%s'", expectedIid, iid)
+		t.Fail()
+	}
+
+	instanceHasher.Reset()
+	instanceHasher.Write(make([]byte, 16))
+	iid, _ = instanceHasher.Code()
+	if iid != "CR8UZLfpaCm1d" {
+		t.Fail()
+	}
+}
+
+func TestReaderSemantics(t *testing.T) {
+	data := make([]byte, 200000)
+	for i := range data {
+		data[i] = byte((i * 7) % 251)
+	}
+	did, err := DataId(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iid, h, err := InstanceId(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// readers returning short chunks produce the same codes
+	for _, r := range []func() io.Reader{
+		func() io.Reader { return iotest.OneByteReader(bytes.NewReader(data)) },
+		func() io.Reader { return iotest.HalfReader(bytes.NewReader(data)) },
+		func() io.Reader { return iotest.DataErrReader(bytes.NewReader(data)) },
+	} {
+		if d, err := DataId(r()); err != nil || d != did {
+			t.Logf("Expected '%s', got '%s' (%v)", did, d, err)
+			t.Fail()
+		}
+		if i, hh, err := InstanceId(r()); err != nil || i != iid || hh != h {
+			t.Logf("Expected '%s', got '%s' (%v)", iid, i, err)
+			t.Fail()
+		}
+	}
+
+	// read errors are surfaced
+	broken := io.MultiReader(bytes.NewReader(data[:1000]), iotest.ErrReader(errors.New("connection reset")))
+	if _, err := DataId(broken); err == nil {
+		t.Fail()
+	}
+	broken = io.MultiReader(bytes.NewReader(data[:1000]), iotest.ErrReader(errors.New("connection reset")))
+	if _, _, err := InstanceId(broken); err == nil {
+		t.Fail()
+	}
+}
+
+func TestMerkleProof(t *testing.T) {
+	for _, size := range []int{16, 64000, 66000, 5*64000 + 3} {
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte(i % 253)
+		}
+		_, h, _ := InstanceId(bytes.NewReader(data))
+		tree, err := InstanceTree(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		top := tree.TopHash()
+		if hex.EncodeToString(top[:]) != h {
+			t.Logf("Expected tophash '%s'", h)
+			t.Fail()
+		}
+
+		for index := 0; index < tree.Leaves(); index++ {
+			end := (index + 1) * INSTANCE_CHUNK_SIZE
+			if end > size {
+				end = size
+			}
+			chunk := data[index*INSTANCE_CHUNK_SIZE : end]
+			proof, err := tree.Proof(index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok, err := VerifyChunk(h, int64(size), index, chunk, proof); !ok || err != nil {
+				t.Logf("size %d: chunk %d not verified", size, index)
+				t.Fail()
+			}
+			if tree.Leaves() > 1 {
+				if ok, _ := VerifyChunk(h, int64(size), index^1, chunk, proof); ok {
+					t.Fail()
+				}
+			}
+			tampered := append([]byte{0xff}, chunk[1:]...)
+			if ok, _ := VerifyChunk(h, int64(size), index, tampered, proof); ok {
+				t.Fail()
+			}
+			if ok, _ := VerifyChunk(h, int64(size), index, chunk, append(proof, proof...)); ok && len(proof) > 0 {
+				t.Fail()
+			}
+		}
+		if _, err := tree.Proof(tree.Leaves()); err == nil {
+			t.Fail()
+		}
+	}
+
+	// the self-paired last chunk of an odd level does not verify beyond it
+	data := make([]byte, 2*INSTANCE_CHUNK_SIZE+100)
+	_, h, _ := InstanceId(bytes.NewReader(data))
+	tree, _ := InstanceTree(bytes.NewReader(data))
+	chunk := data[2*INSTANCE_CHUNK_SIZE:]
+	proof, _ := tree.Proof(2)
+	forged := [][32]byte{leafHash(chunk), proof[1]}
+	if ok, _ := VerifyChunk(h, int64(len(data)), 2, chunk, proof); !ok {
+		t.Fail()
+	}
+	if ok, _ := VerifyChunk(h, int64(len(data)), 3, chunk, forged); ok {
+		t.Error("Verified chunk at index 3 of 3 chunks")
+	}
+}
+
+func TestInstanceIdReaderAt(t *testing.T) {
+	for _, size := range []int{0, 16, 64000, 66000, 7*64000 + 5} {
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte(i % 241)
+		}
+		expectedIid, expectedHash, _ := InstanceId(bytes.NewReader(data))
+		for _, workers := range []int{0, 1, 2, 3, 16} {
+			iid, h, err := InstanceIdReaderAt(bytes.NewReader(data), int64(size), workers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if iid != expectedIid || h != expectedHash {
+				t.Logf("size %d, %d workers: expected '%s', got '%s'", size, workers, expectedIid, iid)
+				t.Fail()
+			}
+		}
+	}
+
+	// size beyond the end of the reader
+	if _, _, err := InstanceIdReaderAt(bytes.NewReader(make([]byte, 100)), 200000, 4); err == nil {
+		t.Fail()
+	}
+}
+
+func TestChunker(t *testing.T) {
+	data := make([]byte, 1000000)
+	for i := range data {
+		data[i] = byte(i % 256)
+	}
+	features, _ := cdc.GetHashedCDC(bytes.NewReader(data))
+
+	chunker := cdc.NewChunker(iotest.HalfReader(bytes.NewReader(data)))
+	var offset int64
+	var chunks []cdc.Chunk
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chunk.Offset != offset || chunk.Length != len(chunk.Data) || !bytes.Equal(chunk.Data, data[offset:offset+int64(chunk.Length)]) {
+			t.Fatalf("Unexpected chunk at %d", offset)
+		}
+		offset += int64(chunk.Length)
+		chunks = append(chunks, chunk)
+	}
+	if offset != int64(len(data)) || len(chunks) != len(features) {
+		t.Fatalf("Expected %d chunks, got %d", len(features), len(chunks))
+	}
+	for i, chunk := range chunks {
+		if chunk.Hash != features[i] {
+			t.Fail()
+		}
+	}
+	if _, err := chunker.Next(); err != io.EOF {
+		t.Fail()
+	}
+}
+
+func TestDiffData(t *testing.T) {
+	a := make([]byte, 300000)
+	rnd := uint32(7)
+	for i := range a {
+		rnd = rnd*1664525 + 1013904223
+		a[i] = byte(rnd >> 24)
+	}
+	// changed header and data inserted in the middle
+	b := append([]byte{}, a[:150000]...)
+	b = append(b, bytes.Repeat([]byte{'x'}, 100)...)
+	b = append(b, a[150000:]...)
+	copy(b[10:], "changed")
+
+	diff, err := DiffData(bytes.NewReader(a), bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.SizeA != int64(len(a)) || diff.SizeB != int64(len(b)) {
+		t.Fail()
+	}
+	if len(diff.Ranges) != 4 || diff.Ranges[0].Equal || !diff.Ranges[1].Equal || diff.Ranges[2].Equal || !diff.Ranges[3].Equal {
+		t.Fatalf("Unexpected ranges %+v", diff.Ranges)
+	}
+	middle := diff.Ranges[2]
+	if middle.AOffset > 150000 || middle.AOffset+middle.ALength < 150000 || middle.BLength-middle.ALength != 100 {
+		t.Logf("Unexpected range %+v", middle)
+		t.Fail()
+	}
+	var shared int64
+	for _, r := range diff.Ranges {
+		if r.Equal {
+			if !bytes.Equal(a[r.AOffset:r.AOffset+r.ALength], b[r.BOffset:r.BOffset+r.BLength]) {
+				t.Fail()
+			}
+			shared += r.ALength
+		}
+	}
+	if shared != diff.SharedBytes || diff.SharedRatio < 0.9 || diff.SharedRatio >= 1 {
+		t.Logf("Unexpected shared ratio %f", diff.SharedRatio)
+		t.Fail()
+	}
+
+	diff, _ = DiffData(bytes.NewReader(a), bytes.NewReader(a))
+	if len(diff.Ranges) != 1 || !diff.Ranges[0].Equal || diff.SharedRatio != 1 {
+		t.Fail()
+	}
+	diff, _ = DiffData(bytes.NewReader(nil), bytes.NewReader(a[:10]))
+	if len(diff.Ranges) != 1 || diff.Ranges[0].Equal || diff.SharedRatio != 0 {
+		t.Fail()
+	}
+
+	// large, fully different inputs beyond DIFF_MAX_EDITS keep prefix and
+	// suffix and report the middle as changed
+	refs := func(n int, tag byte) []chunkRef {
+		chunks := make([]chunkRef, n)
+		for i := range chunks {
+			chunks[i].digest[0] = tag
+			binary.BigEndian.PutUint32(chunks[i].digest[1:], uint32(i))
+		}
+		return chunks
+	}
+	chunksA, chunksB := refs(300000, 'a'), refs(300000, 'b')
+	chunksA[0], chunksA[len(chunksA)-1] = chunksB[0], chunksB[len(chunksB)-1]
+	matches := alignChunks(chunksA, chunksB)
+	if len(matches) != 2 || matches[0] != [2]int{0, 0} || matches[1] != [2]int{299999, 299999} {
+		t.Errorf("Unexpected matches %v", matches)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	text := "Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt"
+	cid, _ := ContentIdText(text, false)
+	defaultCid, err := DefaultProfile.ContentIdText(text, false)
+	if err != nil || defaultCid != cid {
+		t.Fail()
+	}
+
+	custom := DefaultProfile
+	custom.Name = "research"
+	custom.WindowSizeCidT = 3
+	custom.InstanceChunkSize = 1024
+	custom.Chunking.Gear1.Max = 320
+	customCid, err := custom.ContentIdText(text, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if customCid == cid {
+		t.Fail()
+	}
+
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte(i % 256)
+	}
+	code, _, err := GenerateFromReader(bytes.NewReader(data), GenerateOptions{ContentId: cid, Profile: &custom})
+	if err != nil {
+		t.Fatal(err)
+	}
+	iid, _, _ := custom.InstanceId(bytes.NewReader(data))
+	defaultIid, _, _ := InstanceId(bytes.NewReader(data))
+	if code.Profile != "research" || code.InstanceId() != iid || iid == defaultIid {
+		t.Fail()
+	}
+	defaultCode, _, _ := GenerateFromReader(bytes.NewReader(data), GenerateOptions{ContentId: cid})
+	if defaultCode.Profile != DEFAULT_PROFILE_NAME {
+		t.Fail()
+	}
+	if _, err := Compare(code, defaultCode); err == nil {
+		t.Fail()
+	}
+	assembled, err := custom.NewISCC(code.MetaId(), code.ContentId(), code.DataId(), code.InstanceId())
+	if err != nil || assembled != code {
+		t.Fail()
+	}
+	if parsed, _ := ParseISCC(code.String()); parsed.Profile != "" {
+		t.Fail()
+	}
+
+	invalid := DefaultProfile
+	invalid.WindowSizeMid = 1
+	if _, _, _, err := invalid.MetaId("Title", "", 1); !errors.Is(err, ErrInvalidWindowWidth) {
+		t.Error(err)
+	}
+	invalid = DefaultProfile
+	invalid.Chunking.Gear2.Min = 0
+	if _, err := invalid.DataId(bytes.NewReader(data)); err == nil {
+		t.Fail()
+	}
+}
+
+func TestErrors(t *testing.T) {
+	if _, _, _, err := MetaId("Title", "", 2); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Error(err)
+	}
+	if _, err := ParseISCC("CCDFPFc87MhdT"); !errors.Is(err, ErrInvalidCodeLength) {
+		t.Error(err)
+	}
+	var charErr *base58.InvalidCharacterError
+	_, err := ParseISCC("CCDFPFc87MhdT-CT7BA4C5hb3eJ-CDYFMBsi8ujBt-CRIQvk4TSGDMz")
+	if !errors.Is(err, ErrInvalidCharacter) || !errors.As(err, &charErr) || charErr.Char != 'I' {
+		t.Error(err)
+	}
+	var headerErr *HeaderError
+	_, err = NewISCC("CCDFPFc87MhdT", "CCDFPFc87MhdT", "CCDFPFc87MhdT", "CCDFPFc87MhdT")
+	if !errors.Is(err, ErrUnknownHeader) || !errors.As(err, &headerErr) || headerErr.Header != HEAD_MID {
+		t.Error(err)
+	}
+	if _, err := Distance("CCDFPFc87MhdT", "CCDFPFc87MhdT"[2:]); !errors.Is(err, ErrInvalidCodeLength) {
+		t.Error(err)
+	}
+	if _, err := Distance("CCDFPFc87MhdT", "CTiesaXaMqbbU"); !errors.As(err, &headerErr) || headerErr.Header != HEAD_CID_T {
+		t.Error(err)
+	}
+	if err := index.New().Add("id", "CTiesaXaMqbbU", "27iesaXaMqbbU"); !errors.Is(err, ErrUnknownHeader) {
+		t.Error(err)
+	}
+	if _, err := createNGramWindowsLetterWise("text", 1); !errors.Is(err, ErrInvalidWindowWidth) {
+		t.Error(err)
+	}
+	if _, err := createNGramWindowsWordWise([]string{"a", "b"}, 1); !errors.Is(err, ErrInvalidWindowWidth) {
+		t.Error(err)
+	}
+	if _, err := hashes.SimilarityHash([][]byte{{1}, {1, 2}}); !errors.Is(err, ErrInconsistentDigests) {
+		t.Error(err)
+	}
+	if _, err := hashes.SimilarityHash([][]byte{make([]byte, 9)}); !errors.Is(err, ErrInvalidDigestLength) {
+		t.Error(err)
+	}
+	if _, err := ContentIdMixed(nil, false); !errors.Is(err, ErrEmptyInput) {
+		t.Error(err)
+	}
+	for _, header := range []string{"W0 H10", "W-4 H10", "W3000000000 H3000000000", "W60000 H60000"} {
+		stream := strings.NewReader("YUV4MPEG2 " + header + "\nFRAME\n")
+		if _, err := ContentIdVideoFromFile(stream, false); !errors.Is(err, ErrInvalidFrameSize) {
+			t.Errorf("%s: %v", header, err)
+		}
+	}
+
+	// profiles, sizes and the registry
+	var profileErr *ProfileError
+	invalid := DefaultProfile
+	invalid.WindowSizeCidT = 1
+	if _, err := invalid.ContentIdText("text", false); !errors.Is(err, ErrInvalidProfile) || !errors.Is(err, ErrInvalidWindowWidth) {
+		t.Error(err)
+	}
+	invalid = DefaultProfile
+	invalid.ImageSize = 4
+	if err := invalid.Validate(); !errors.As(err, &profileErr) || profileErr.Profile != DEFAULT_PROFILE_NAME {
+		t.Error(err)
+	}
+	invalid = DefaultProfile
+	invalid.Chunking.Gear1.Min = 0
+	if err := invalid.Validate(); !errors.Is(err, ErrInvalidProfile) {
+		t.Error(err)
+	}
+	a, _ := ParseISCC("CCDFPFc87MhdT-CTiesaXaMqbbU-CD86h6EiEUiJW-CR8UZLfpaCm1d")
+	b := a
+	a.Profile, b.Profile = "a", "b"
+	if _, err := Compare(a, b); !errors.Is(err, ErrProfileMismatch) {
+		t.Error(err)
+	}
+	if _, _, err := InstanceIdReaderAt(bytes.NewReader(nil), -1, 1); !errors.Is(err, ErrInvalidSize) {
+		t.Error(err)
+	}
+	if _, err := VerifyChunk(strings.Repeat("00", 32), -1, 0, nil, nil); !errors.Is(err, ErrInvalidSize) {
+		t.Error(err)
+	}
+	if _, err := VerifyChunk("00", 0, 0, nil, nil); !errors.Is(err, ErrInvalidCodeLength) {
+		t.Error(err)
+	}
+	tree, _ := InstanceTree(bytes.NewReader(nil))
+	if _, err := tree.Proof(1); !errors.Is(err, ErrChunkOutOfRange) {
+		t.Error(err)
+	}
+	if err := RegisterContentGenerator(pairGenerator{header: 0x20, partialHeader: 0x21}); !errors.Is(err, ErrUnknownHeader) {
+		t.Error(err)
+	}
+	if err := RegisterContentGenerator(pairGenerator{header: 0xf2, partialHeader: 0xf4}); !errors.Is(err, ErrUnknownHeader) {
+		t.Error(err)
+	}
+	builtin, _ := ContentGeneratorForHeader(HEAD_CID_T)
+	if err := register(builtin); !errors.Is(err, ErrAlreadyRegistered) {
+		t.Error(err)
+	}
+}
+
+func TestDegenerateInputs(t *testing.T) {
+	// 1. Empty inputs with a defined code
+	if _, _, _, err := MetaId("", "", 1); err != nil {
+		t.Error(err)
+	}
+	if _, err := ContentIdText("", false); err != nil {
+		t.Error(err)
+	}
+	if _, err := DataId(bytes.NewReader(nil)); err != nil {
+		t.Error(err)
+	}
+	if _, _, err := InstanceId(bytes.NewReader(nil)); err != nil {
+		t.Error(err)
+	}
+	for _, img := range []image.Image{image.NewGray(image.Rect(0, 0, 1, 1)), image.NewRGBA(image.Rect(7, 3, 8, 4))} {
+		if _, err := ContentIdImage(img, false); err != nil {
+			t.Error(err)
+		}
+	}
+	for _, text := range []string{"abcü", "üüüü", strings.Repeat("ü", 64)} {
+		for limit := 0; limit <= len(text)+1; limit++ {
+			if trimmed := textTrim(text, limit); len(trimmed) > limit || !strings.HasPrefix(text, trimmed) {
+				t.Errorf("textTrim(%q, %d) = %q", text, limit, trimmed)
+			}
+		}
+	}
+
+	// 2. Inputs without content are rejected
+	for name, f := range map[string]func() (string, error){
+		"image":       func() (string, error) { return ContentIdImage(image.NewGray(image.Rect(0, 0, 0, 0)), false) },
+		"image file":  func() (string, error) { return ContentIdImageFromFile(bytes.NewReader(nil), false) },
+		"audio":       func() (string, error) { return ContentIdAudio(nil, 44100, false) },
+		"audio file":  func() (string, error) { return ContentIdAudioFromFile(bytes.NewReader(nil), false) },
+		"video file":  func() (string, error) { return ContentIdVideoFromFile(bytes.NewReader(nil), false) },
+		"mixed":       func() (string, error) { return ContentIdMixed([]string{}, false) },
+		"simhash":     func() (string, error) { _, err := hashes.SimilarityHash(nil); return "", err },
+		"short audio": func() (string, error) { return ContentIdAudio(make([]float64, 100), 8000, false) },
+	} {
+		if _, err := f(); !errors.Is(err, ErrEmptyInput) {
+			t.Errorf("%s: expected ErrEmptyInput, got %v", name, err)
+		}
+	}
+	mid, _, _, _ := MetaId("Title", "", 1)
+	for _, cids := range [][]string{{"CC"}, {mid}, {"CCDFPFc87MhdI"}} {
+		if _, err := ContentIdMixed(cids, false); err == nil {
+			t.Errorf("Expected error for %v", cids)
+		}
+	}
+}
+
+func FuzzGenerators(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0})
+	f.Add([]byte("ü"))
+	f.Add([]byte("RIFF\x24\x00\x00\x00WAVEfmt "))
+	f.Add([]byte("YUV4MPEG2 W1 H1 F1:1\nFRAME\n\x80\x80\x80"))
+	f.Add([]byte("YUV4MPEG2 W3000000000 H3000000000\nFRAME\n"))
+	f.Add([]byte("YUV4MPEG2 W60000 H60000\nFRAME\n"))
+	f.Add([]byte("\x89PNG\r\n\x1a\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		MetaId(string(data), string(data), 1)
+		ContentIdText(string(data), len(data)%2 == 0)
+		ContentIdImageFromFile(bytes.NewReader(data), false)
+		ContentIdAudioFromFile(bytes.NewReader(data), false)
+		ContentIdVideoFromFile(bytes.NewReader(data), false)
+		ContentIdMixed(strings.Fields(string(data)), false)
+		DataId(bytes.NewReader(data))
+		InstanceId(bytes.NewReader(data))
+		GenerateFromReader(bytes.NewReader(data), GenerateOptions{})
+		ParseISCC(string(data))
+		base58.Decode(string(data))
+		if len(data) > 0 {
+			samples := make([]float64, len(data))
+			for i, b := range data {
+				samples[i] = float64(b) - 128
+			}
+			ContentIdAudio(samples, int(data[0]), false)
+			width := int(data[0]%4) + 1
+			img := image.NewGray(image.Rect(0, 0, width, len(data)/width))
+			copy(img.Pix, data)
+			ContentIdImage(img, false)
+		}
+	})
+}
+
+func FuzzY4MHeader(f *testing.F) {
+	f.Add("W1 H1 F1:1 Cmono")
+	f.Add("W3000000000 H3000000000")
+	f.Add("W60000 H60000 C444")
+	f.Add("W-1 H-1")
+	f.Add("W9223372036854775807 H2 F0:0")
+	f.Add("W1 H1 F1:9223372036 Cmono")
+	f.Fuzz(func(t *testing.T, params string) {
+		stream := "YUV4MPEG2 " + strings.ReplaceAll(params, "\n", " ") + "\nFRAME\n\x80\nFRAME\n\x80"
+		ContentIdVideoFromFile(strings.NewReader(stream), false)
+	})
+}
+
+func TestContextLimits(t *testing.T) {
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	ctx := context.Background()
+
+	// 1. Inputs within limits give the regular codes
+	did, _ := DataId(bytes.NewReader(data))
+	if code, err := DataIdContext(ctx, bytes.NewReader(data), Limits{MaxBytes: int64(len(data))}); err != nil || code != did {
+		t.Error(code, err)
+	}
+	var limitErr *LimitError
+	_, _, err := InstanceIdContext(ctx, bytes.NewReader(data), Limits{MaxBytes: int64(len(data)) - 1})
+	if !errors.Is(err, ErrLimitExceeded) || !errors.As(err, &limitErr) || limitErr.Limit != "bytes" {
+		t.Error(err)
+	}
+
+	// 2. Cancellation aborts
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := DataIdContext(cancelled, bytes.NewReader(data), Limits{}); !errors.Is(err, context.Canceled) {
+		t.Error(err)
+	}
+
+	// 3. Image dimensions are checked
+	img := image.NewGray(image.Rect(0, 0, 64, 64))
+	copy(img.Pix, data)
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	cid, _ := ContentIdImage(img, false)
+	if code, err := ContentIdImageFromFileContext(ctx, bytes.NewReader(buf.Bytes()), false, Limits{MaxPixels: 64 * 64}); err != nil || code != cid {
+		t.Error(code, err)
+	}
+	_, err = ContentIdImageFromFileContext(ctx, bytes.NewReader(buf.Bytes()), false, Limits{MaxPixels: 64*64 - 1})
+	if !errors.As(err, &limitErr) || limitErr.Limit != "pixels" || limitErr.Actual != 64*64 {
+		t.Error(err)
+	}
+}
+
+func TestContentIdAuto(t *testing.T) {
+	text := "Some text that is long enough to make up several shingles of words"
+	cidText, _ := ContentIdText(text, false)
+	if cid, gmt, err := ContentIdAuto(strings.NewReader(text), false); err != nil || gmt != GMT_TEXT || cid != cidText {
+		t.Error(cid, gmt, err)
+	}
+
+	img := image.NewGray(image.Rect(0, 0, 40, 40))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i * 13)
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	cidImage, _ := ContentIdImage(img, true)
+	if cid, gmt, err := ContentIdAuto(&buf, true); err != nil || gmt != GMT_IMAGE || cid != cidImage {
+		t.Error(cid, gmt, err)
+	}
+
+	var mediaErr *MediaTypeError
+	_, _, err := ContentIdAuto(strings.NewReader("%PDF-1.4\n"), false)
+	if !errors.Is(err, ErrUnsupportedMedia) || !errors.As(err, &mediaErr) || mediaErr.MediaType != "application/pdf" {
+		t.Error(err)
+	}
+}
+
+type lengthGenerator struct{}
+
+func (lengthGenerator) Name() string         { return "Content-ID Length" }
+func (lengthGenerator) MediaTypes() []string { return []string{"application/postscript"} }
+func (lengthGenerator) Header() byte         { return 0xf0 }
+func (lengthGenerator) PartialHeader() byte  { return 0xf1 }
+func (lengthGenerator) Generate(r io.Reader) ([]byte, error) {
+	n, err := io.Copy(io.Discard, r)
+	digest := make([]byte, 8)
+	binary.BigEndian.PutUint64(digest, uint64(n))
+	return digest, err
+}
+
+// pairGenerator is a lengthGenerator with other headers.
+type pairGenerator struct {
+	lengthGenerator
+	header, partialHeader byte
+}
+
+func (g pairGenerator) Header() byte         { return g.header }
+func (g pairGenerator) PartialHeader() byte  { return g.partialHeader }
+func (g pairGenerator) MediaTypes() []string { return nil }
+
+func TestContentGeneratorRegistry(t *testing.T) {
+	if err := RegisterContentGenerator(lengthGenerator{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { unregister(lengthGenerator{}) })
+	if err := RegisterContentGenerator(lengthGenerator{}); err == nil {
+		t.Error("Expected error registering a header twice")
+	}
+	// components are compared without the partial flag, so headers must pair up
+	for _, g := range []pairGenerator{{header: 0xf2, partialHeader: 0xf4}, {header: 0xf3, partialHeader: 0xf5}, {header: 0xf3, partialHeader: 0xf2}} {
+		if err := RegisterContentGenerator(g); err == nil {
+			unregister(g)
+			t.Errorf("Registered headers 0x%02x and 0x%02x", g.header, g.partialHeader)
+		}
+	}
+	builtin, _ := ContentGeneratorForHeader(HEAD_CID_T)
+	if err := RegisterContentGenerator(builtin); err == nil {
+		t.Error("Expected error registering outside of the private range")
+	}
+
+	postscript := "%!PS-Adobe-3.0\n"
+	cid, gmt, err := ContentIdAuto(strings.NewReader(postscript), true)
+	if err != nil || gmt != GMT_PRIVATE {
+		t.Fatal(cid, gmt, err)
+	}
+	digest, _ := base58.Decode(cid)
+	if digest[0] != 0xf1 || binary.BigEndian.Uint64(digest[1:]) != uint64(len(postscript)) {
+		t.Errorf("Unexpected digest %x", digest)
+	}
+	if ComponentName(0xf1) != "Content-ID Length" || !IsPartial(0xf1) || IsPartial(0xf0) {
+		t.Fail()
+	}
+	if ComponentName(0xe0) != "Unknown" {
+		t.Fail()
+	}
+
+	// private components make up full codes
+	code, _, err := GenerateFromReader(strings.NewReader(postscript), GenerateOptions{Partial: true})
+	if err != nil || code.Gmt != GMT_PRIVATE || !code.Partial || code.ContentId() != cid {
+		t.Fatal(code, err)
+	}
+	parsed, err := ParseISCC(code.String())
+	parsed.Profile = code.Profile
+	if err != nil || parsed != code || parsed.ContentHeader() != 0xf1 {
+		t.Error(parsed, err)
+	}
+}
+
+func TestContentIdHTML(t *testing.T) {
+	page := `<!DOCTYPE html><html><head><title> The  Title </title><style>p {}</style></head>
+<body><nav><a href="/">Home</a></nav><div role="banner">Banner</div>
+<h1>Heading</h1><p>First <b>para</b>graph</p><p>Second paragraph<br>new line</p>
+<script>var x = 1;</script><footer>Footer</footer></body></html>`
+
+	text, title, err := htmltext.Extract(strings.NewReader(page))
+	if err != nil || title != "The Title" || text != "Heading\nFirst paragraph\nSecond paragraph\nnew line" {
+		t.Errorf("%q %q %v", text, title, err)
+	}
+
+	cidText, _ := ContentIdText("Heading First paragraph Second paragraph new line", false)
+	cid, title, err := ContentIdHTML(strings.NewReader(page), false)
+	if err != nil || cid != cidText || title != "The Title" {
+		t.Error(cid, title, err)
+	}
+	if cid, gmt, err := ContentIdAuto(strings.NewReader(page), false); err != nil || gmt != GMT_TEXT || cid != cidText {
+		t.Error(cid, gmt, err)
+	}
+}
+
+// makeEPUB builds an EPUB with two chapters, listed in the spine in
+// reverse manifest order, and the given PNG images.
+func makeEPUB(t *testing.T, images map[string]image.Image) []byte {
+	files := map[string]string{
+		"mimetype": epub.MEDIA_TYPE,
+		epub.CONTAINER_PATH: `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+<rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`,
+		"OEBPS/text/chapter 1.xhtml": `<html xmlns="http://www.w3.org/1999/xhtml"><head><title>One</title></head><body><p>Second chapter of the book</p></body></html>`,
+		"OEBPS/text/chapter2.xhtml":  `<html xmlns="http://www.w3.org/1999/xhtml"><head><title>Two</title></head><body><h1>First</h1><p>chapter of the book</p></body></html>`,
+	}
+	var items string
+	for name, img := range images {
+		items += `<item id="` + name + `" href="` + name + `" media-type="image/png"/>`
+		if img == nil {
+			// listed in the manifest but missing from the archive
+			continue
+		}
+		var encoded bytes.Buffer
+		if err := png.Encode(&encoded, img); err != nil {
+			t.Fatal(err)
+		}
+		files["OEBPS/"+name] = encoded.String()
+	}
+	files["OEBPS/content.opf"] = `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>A Book</dc:title><dc:creator>Jane Doe</dc:creator><dc:creator>John Roe</dc:creator></metadata>
+<manifest><item id="c1" href="text/chapter%201.xhtml" media-type="application/xhtml+xml"/><item id="c2" href="text/chapter2.xhtml" media-type="application/xhtml+xml"/>` + items + `</manifest>
+<spine><itemref idref="c2"/><itemref idref="c1"/></spine>
+</package>`
+	return makeZip(t, files)
+}
+
+func TestContentIdEPUB(t *testing.T) {
+	// 1. Text only
+	data := makeEPUB(t, nil)
+	if !epub.IsEPUB(data) {
+		t.Fatal("EPUB not detected")
+	}
+	cidText, _ := ContentIdText("First chapter of the book Second chapter of the book", true)
+	cid, title, creators, err := ContentIdEPUB(bytes.NewReader(data), int64(len(data)), true)
+	if err != nil || cid != cidText || title != "A Book" || creators != "Jane Doe, John Roe" {
+		t.Error(cid, title, creators, err)
+	}
+
+	// 2. Significant images make a mixed Content-ID
+	cover := image.NewGray(image.Rect(0, 0, EPUB_MIN_IMAGE_SIZE, EPUB_MIN_IMAGE_SIZE+10))
+	for i := range cover.Pix {
+		cover.Pix[i] = byte(i / 97)
+	}
+	data = makeEPUB(t, map[string]image.Image{"cover.png": cover, "icon.png": image.NewGray(image.Rect(0, 0, 16, 16))})
+	textId, _ := ContentIdText("First chapter of the book Second chapter of the book", false)
+	coverId, _ := ContentIdImage(cover, false)
+	mixedId, _ := ContentIdMixed([]string{textId, coverId}, false)
+	if cid, _, _, err := ContentIdEPUB(bytes.NewReader(data), int64(len(data)), false); err != nil || cid != mixedId {
+		t.Error(cid, err)
+	}
+
+	// 3. Text weighs as much as all images, missing images are skipped
+	back := image.NewGray(cover.Bounds())
+	for i := range back.Pix {
+		back.Pix[i] = byte(i / 89)
+	}
+	data = makeEPUB(t, map[string]image.Image{"cover.png": cover, "back.png": back, "missing.png": nil})
+	backId, _ := ContentIdImage(back, false)
+	mixedId, _ = ContentIdMixed([]string{textId, textId, coverId, backId}, false)
+	if cid, _, _, err := ContentIdEPUB(bytes.NewReader(data), int64(len(data)), false); err != nil || cid != mixedId {
+		t.Error(cid, err)
+	}
+
+	// 4. EPUB are detected by the registry
+	if cid, gmt, err := ContentIdAuto(bytes.NewReader(data), false); err != nil || gmt != GMT_MIXED || cid != mixedId {
+		t.Error(cid, gmt, err)
+	}
+	code, _, err := GenerateFromReader(bytes.NewReader(data), GenerateOptions{})
+	if err != nil || code.ContentId() != mixedId {
+		t.Error(code, err)
+	}
+	data = makeEPUB(t, nil)
+	if cid, gmt, err := ContentIdAuto(bytes.NewReader(data), true); err != nil || gmt != GMT_TEXT || cid != cidText {
+		t.Error(cid, gmt, err)
+	}
+}
+
+// makeZip builds a zip archive of the files in name order. A mimetype
+// file comes first and uncompressed as in EPUB and ODF packages.
+func makeZip(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		if name != "mimetype" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if _, ok := files["mimetype"]; ok {
+		names = append([]string{"mimetype"}, names...)
+	}
+	for _, name := range names {
+		method := zip.Deflate
+		if name == "mimetype" {
+			method = zip.Store
+		}
+		f, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(files[name]))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestContentIdOffice(t *testing.T) {
+	core := `<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>Report</dc:title><dc:creator>Jane Doe</dc:creator></cp:coreProperties>`
+	documents := []struct {
+		format string
+		files  map[string]string
+		text   string
+	}{
+		{office.FORMAT_DOCX, map[string]string{
+			"docProps/core.xml": core,
+			"word/document.xml": `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:r><w:t>First</w:t></w:r><w:r><w:t xml:space="preserve"> para</w:t></w:r><w:r><w:t>graph</w:t></w:r></w:p>
+<w:p><w:r><w:t>Second</w:t></w:r><w:del><w:r><w:delText>deleted</w:delText></w:r></w:del><w:r><w:tab/><w:t>one</w:t></w:r></w:p>
+</w:body></w:document>`,
+		}, "First paragraph\nSecond\tone"},
+		{office.FORMAT_PPTX, map[string]string{
+			"docProps/core.xml":               core,
+			"ppt/presentation.xml":            `<p:presentation xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><p:sldIdLst><p:sldId id="256" r:id="rId3"/><p:sldId id="257" r:id="rId2"/></p:sldIdLst></p:presentation>`,
+			"ppt/_rels/presentation.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId2" Target="slides/slide1.xml"/><Relationship Id="rId3" Target="slides/slide2.xml"/></Relationships>`,
+			"ppt/slides/slide1.xml":           `<p:sld xmlns:p="p" xmlns:a="a"><a:p><a:r><a:t>Second slide</a:t></a:r></a:p></p:sld>`,
+			"ppt/slides/slide2.xml":           `<p:sld xmlns:p="p" xmlns:a="a"><a:p><a:r><a:t>First</a:t></a:r><a:br/><a:r><a:t>slide</a:t></a:r></a:p></p:sld>`,
+		}, "First\nslide\nSecond slide"},
+		{office.FORMAT_XLSX, map[string]string{
+			"docProps/core.xml":    core,
+			"xl/workbook.xml":      `<workbook/>`,
+			"xl/sharedStrings.xml": `<sst><si><t>Cell one</t></si><si><r><t>Cell</t></r><r><t xml:space="preserve"> two</t></r><rPh><t>phonetic</t></rPh></si></sst>`,
+		}, "Cell one\nCell two"},
+		{office.FORMAT_ODT, map[string]string{
+			"mimetype": office.MEDIA_TYPE_ODT,
+			"meta.xml": `<office:document-meta xmlns:office="o" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:meta="m"><office:meta><dc:title>Report</dc:title><meta:initial-creator>Jane Doe</meta:initial-creator><dc:creator>Jane Doe</dc:creator></office:meta></office:document-meta>`,
+			"content.xml": `<office:document-content xmlns:office="o" xmlns:text="t"><office:body><office:text>
+<text:h>Heading</text:h><text:p>Some<text:s text:c="2"/><text:span>styled</text:span> text<text:note><text:note-body><text:p>Footnote</text:p></text:note-body></text:note></text:p>
+</office:text></office:body></office:document-content>`,
+		}, "Heading\nSome  styled text"},
+	}
+	for _, d := range documents {
+		data := makeZip(t, d.files)
+		doc, err := office.Open(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(d.format, err)
+		}
+		text, err := doc.Text()
+		if err != nil || doc.Format != d.format || text != d.text {
+			t.Errorf("%s: %q %v", d.format, text, err)
+		}
+		cidText, _ := ContentIdText(strings.Join(strings.Fields(d.text), " "), false)
+		cid, title, creators, err := ContentIdOffice(bytes.NewReader(data), int64(len(data)), false)
+		if err != nil || cid != cidText || title != "Report" || creators != "Jane Doe" {
+			t.Error(d.format, cid, title, creators, err)
+		}
+
+		// detected by the registry
+		if office.Detect(data) == "" {
+			t.Errorf("%s not detected", d.format)
+		}
+		if cid, gmt, err := ContentIdAuto(bytes.NewReader(data), false); err != nil || gmt != GMT_TEXT || cid != cidText {
+			t.Error(d.format, cid, gmt, err)
+		}
+		code, _, err := GenerateFromReader(bytes.NewReader(data), GenerateOptions{})
+		if err != nil || code.ContentId() != cidText {
+			t.Error(d.format, code, err)
+		}
+	}
+
+	data := makeZip(t, map[string]string{"readme.txt": "Not an office document"})
+	if _, err := office.Open(bytes.NewReader(data), int64(len(data))); !errors.Is(err, office.ErrUnsupportedFormat) {
+		t.Error(err)
+	}
+	if office.Detect(data) != "" {
+		t.Fail()
+	}
+
+	// OOXML packages of other formats have no Content-ID
+	data = makeZip(t, map[string]string{"[Content_Types].xml": "<Types/>", "visio/document.xml": "<VisioDocument/>"})
+	if _, _, err := ContentIdAuto(bytes.NewReader(data), false); !errors.Is(err, ErrUnsupportedMedia) {
+		t.Error(err)
+	}
+	if code, _, err := GenerateFromReader(bytes.NewReader(data), GenerateOptions{}); err != nil || code.HasContent() {
+		t.Error(code, err)
+	}
+}
@@ -0,0 +1,143 @@
+package iscc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"io"
+)
+
+// MerkleTree is the binary hash tree over the 64 kB chunks the Instance-ID
+// is derived from. Levels[0] holds the leaf node digests, the last level
+// the tophash.
+type MerkleTree struct {
+	Levels [][][32]byte
+}
+
+// InstanceTree builds the full Merkle tree of the Instance-ID of r.
+func InstanceTree(r io.Reader) (*MerkleTree, error) {
+	return DefaultProfile.InstanceTree(r)
+}
+
+func (p Profile) InstanceTree(r io.Reader) (*MerkleTree, error) {
+	hasher, err := p.NewInstanceHasher()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(hasher, r); err != nil {
+		return nil, err
+	}
+	return hasher.Tree(), nil
+}
+
+func newMerkleTree(leafNodeDigests [][32]byte) *MerkleTree {
+	levels := [][][32]byte{leafNodeDigests}
+	for level := leafNodeDigests; len(level) > 1; {
+		// an odd node is paired with itself as in topHash
+		next := make([][32]byte, (len(level)+1)/2)
+		for i := range next {
+			right := level[len(level)-1]
+			if 2*i+1 < len(level) {
+				right = level[2*i+1]
+			}
+			next[i] = hashInnerNodes(level[2*i], right)
+		}
+		levels = append(levels, next)
+		level = next
+	}
+	return &MerkleTree{levels}
+}
+
+// TopHash returns the root of the tree.
+func (t *MerkleTree) TopHash() [32]byte {
+	return t.Levels[len(t.Levels)-1][0]
+}
+
+// Leaves returns the number of chunks.
+func (t *MerkleTree) Leaves() int {
+	return len(t.Levels[0])
+}
+
+// Proof returns the sibling digests on the path from the leaf of the chunk
+// with the given index to the root.
+func (t *MerkleTree) Proof(index int) ([][32]byte, error) {
+	if index < 0 || index >= t.Leaves() {
+		return nil, errors.Wrapf(ErrChunkOutOfRange, "%d not in [0, %d)", index, t.Leaves())
+	}
+	proof := make([][32]byte, 0, len(t.Levels)-1)
+	for _, level := range t.Levels[:len(t.Levels)-1] {
+		sibling := index ^ 1
+		if sibling >= len(level) {
+			sibling = index
+		}
+		proof = append(proof, level[sibling])
+		index /= 2
+	}
+	return proof, nil
+}
+
+// VerifyChunk checks that chunk is the chunk with the given index of the
+// content of size bytes identified by the hex encoded tophash. The size
+// fixes the number of chunks and the length of each chunk. It must come
+// from a trusted source as the tophash does not commit to it.
+func VerifyChunk(tophashHex string, size int64, index int, chunk []byte, proof [][32]byte) (bool, error) {
+	return DefaultProfile.VerifyChunk(tophashHex, size, index, chunk, proof)
+}
+
+func (p Profile) VerifyChunk(tophashHex string, size int64, index int, chunk []byte, proof [][32]byte) (bool, error) {
+	if err := p.Validate(); err != nil {
+		return false, err
+	}
+	tophash, err := hex.DecodeString(tophashHex)
+	if err != nil {
+		return false, errors.Wrap(err, "Invalid tophash")
+	}
+	if len(tophash) != 32 {
+		return false, errors.Wrapf(ErrInvalidCodeLength, "Tophash must be 32 bytes long, got %d", len(tophash))
+	}
+	if size < 0 {
+		return false, errors.Wrapf(ErrInvalidSize, "%d", size)
+	}
+
+	// 1. Verify index and chunk length against the size
+	chunkSize := int64(p.InstanceChunkSize)
+	leaves := int((size + chunkSize - 1) / chunkSize)
+	if leaves == 0 {
+		leaves = 1
+	}
+	if index < 0 || index >= leaves {
+		return false, nil
+	}
+	expected := chunkSize
+	if index == leaves-1 {
+		expected = size - int64(index)*chunkSize
+	}
+	if int64(len(chunk)) != expected {
+		return false, nil
+	}
+
+	// 2. Hash the chunk to its leaf node
+	node := leafHash(chunk)
+
+	// 3. Combine with the siblings up to the root. Only the last node of a
+	// level with an odd number of nodes is paired with itself.
+	for width := leaves; width > 1; width = (width + 1) / 2 {
+		if len(proof) == 0 {
+			return false, nil
+		}
+		sibling := proof[0]
+		proof = proof[1:]
+		switch {
+		case index%2 == 1:
+			node = hashInnerNodes(sibling, node)
+		case index+1 < width:
+			node = hashInnerNodes(node, sibling)
+		case sibling != node:
+			return false, nil
+		default:
+			node = hashInnerNodes(node, node)
+		}
+		index /= 2
+	}
+	return len(proof) == 0 && bytes.Equal(node[:], tophash), nil
+}
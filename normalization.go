@@ -2,6 +2,7 @@ package iscc
 
 import (
 	"github.com/nfnt/resize"
+	"github.com/pkg/errors"
 	"golang.org/x/text/unicode/norm"
 	"image"
 	"image/color"
@@ -11,14 +12,18 @@ import (
 	"unicode/utf8"
 )
 
-func imageNormalize(img image.Image) (*image.Gray, error) {
+func imageNormalize(img image.Image, size int) (*image.Gray, error) {
+	if img == nil || img.Bounds().Empty() {
+		return nil, errors.Wrap(ErrEmptyInput, "Image has no pixels")
+	}
+
 	// 1. Convert to greyscale
 	bounds := img.Bounds()
-	width, height := bounds.Max.X, bounds.Max.Y
+	width, height := bounds.Dx(), bounds.Dy()
 	grayScaleImage := image.NewGray(image.Rectangle{image.Point{0, 0}, image.Point{width, height}})
 	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
-			pixelColor := img.At(x, y)
+			pixelColor := img.At(bounds.Min.X+x, bounds.Min.Y+y)
 			red, green, blue, _ := pixelColor.RGBA()
 			redNormalized := 299 * uint32(red/256)
 			greenNormalized := 587 * uint32(green/256)
@@ -29,21 +34,46 @@ func imageNormalize(img image.Image) (*image.Gray, error) {
 		}
 	}
 
-	// 2. Resize to 32x32
-	resizedImage := resize.Resize(32, 32, grayScaleImage, resize.Bicubic)
+	// 2. Resize to size x size, 32x32 by default
+	resizedImage := resize.Resize(uint(size), uint(size), grayScaleImage, resize.Bicubic)
 
 	return resizedImage.(*image.Gray), nil
 }
 
-// TODO document
-func textTrim(text string) string {
-	if len(text) < INPUT_TRIM {
+// audioNormalize removes the DC offset and scales the signal to a peak amplitude of 1.
+func audioNormalize(samples []float64) []float64 {
+	if len(samples) == 0 {
+		return samples
+	}
+	mean := 0.0
+	for _, s := range samples {
+		mean += s
+	}
+	mean /= float64(len(samples))
+
+	peak := 0.0
+	normalized := make([]float64, len(samples))
+	for i, s := range samples {
+		normalized[i] = s - mean
+		peak = math.Max(peak, math.Abs(normalized[i]))
+	}
+	if peak > 0 {
+		for i := range normalized {
+			normalized[i] /= peak
+		}
+	}
+	return normalized
+}
+
+// textTrim cuts text to at most limit bytes without splitting a character.
+func textTrim(text string, limit int) string {
+	if len(text) <= limit {
 		return text
 	}
 	maxValidLength := 0
-	for {
-		_, width := utf8.DecodeRuneInString(text[maxValidLength : maxValidLength+4])
-		if maxValidLength+width > INPUT_TRIM {
+	for maxValidLength < len(text) {
+		_, width := utf8.DecodeRuneInString(text[maxValidLength:])
+		if maxValidLength+width > limit {
 			break
 		}
 		maxValidLength += width
@@ -51,6 +81,12 @@ func textTrim(text string) string {
 	return string(text[:maxValidLength])
 }
 
+// textJoinLines separates the lines of text extracted from documents by
+// spaces. Newlines are no word boundaries for textNormalize, spaces are.
+func textJoinLines(text string) string {
+	return strings.Join(strings.Fields(text), "\u0020")
+}
+
 func textPreNormalize(text string) string {
 	return strings.TrimSpace(norm.NFKC.String(text))
 }
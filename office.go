@@ -0,0 +1,34 @@
+package iscc
+
+import (
+	"github.com/coblo/iscc-golang/packages/office"
+	"io"
+	"strings"
+)
+
+// ContentIdOffice creates the text Content-ID of the DOCX, PPTX, XLSX or
+// ODT document of size bytes in r. It also returns the title and the
+// creators of the core properties as suggested title and extra for the
+// Meta-ID. Other zip archives fail with office.ErrUnsupportedFormat.
+func ContentIdOffice(r io.ReaderAt, size int64, partial bool) (contentId, title, creators string, err error) {
+	return DefaultProfile.ContentIdOffice(r, size, partial)
+}
+
+func (p Profile) ContentIdOffice(r io.ReaderAt, size int64, partial bool) (contentId, title, creators string, err error) {
+	// 1. Read metadata
+	doc, err := office.Open(r, size)
+	if err != nil {
+		return
+	}
+	title, creators = doc.Title, strings.Join(doc.Creators, ", ")
+
+	// 2. Extract text in reading order, paragraphs are separated by newlines
+	text, err := doc.Text()
+	if err != nil {
+		return
+	}
+
+	// 3. Create text Content-ID
+	contentId, err = p.ContentIdText(textJoinLines(text), partial)
+	return
+}
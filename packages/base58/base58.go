@@ -1,88 +1,173 @@
 package base58
 
 import (
+	"fmt"
 	"github.com/pkg/errors"
+	"math"
 	"math/big"
 )
 
 const alphabet = "C23456789rB1ZEFGTtYiAaVvMmHUPWXKDNbcdefghLjkSnopRqsJuQwxyz"
 
-var byteToAlphabet = map[byte]uint64{49: 11, 50: 1, 51: 2, 52: 3, 53: 4, 54: 5, 55: 6, 56: 7, 57: 8, 65: 20, 66: 10, 67: 0, 68: 32, 69: 13, 70: 14, 71: 15, 72: 26, 74: 51, 75: 31, 76: 41, 77: 24, 78: 33, 80: 28, 81: 53, 82: 48, 83: 44, 84: 16, 85: 27, 86: 22, 87: 29, 88: 30, 89: 18, 90: 12, 97: 21, 98: 34, 99: 35, 100: 36, 101: 37, 102: 38, 103: 39, 104: 40, 105: 19, 106: 42, 107: 43, 109: 25, 110: 45, 111: 46, 112: 47, 113: 49, 114: 9, 115: 50, 116: 17, 117: 52, 118: 23, 119: 54, 120: 55, 121: 56, 122: 57}
+// digits are the base 58 digits understood by big.Int in alphabet order.
+const digits = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUV"
 
-// Encode encodes a byte slice to a modified base58 string.
-func Encode(digest []byte) (string, error) {
-	if len(digest) == 9 {
-		encodedHead, _ := Encode(digest[:1])
-		encodedBody, _ := Encode(digest[1:])
-		return encodedHead + encodedBody, nil
-	}
+// bytesPerChar is the number of bytes encoded by a base 58 char.
+var bytesPerChar = math.Log(58) / math.Log(256)
 
-	if len(digest) != 1 && len(digest) != 8 {
-		return "", errors.New("Invalid digest length given, must be 1, 8 or 9 bytes long")
-	}
+// Lengths of an encoded ISCC component: one header byte and an 8-byte body.
+const (
+	COMPONENT_BYTES = 9
+	COMPONENT_CHARS = 13
+)
 
-	var bigRadix = big.NewInt(58)
-	var bigHelper = big.NewInt(256)
-	var bigZero = big.NewInt(0)
+var (
+	bigRadix = big.NewInt(58)
+	bigByte  = big.NewInt(256)
+)
 
-	value := big.NewInt(0)
-	numValues := big.NewInt(1)
-	for i := len(digest) - 1; i >= 0; i-- {
-		octet := new(big.Int).Mul(big.NewInt(int64(digest[i])), numValues)
-		value = new(big.Int).Add(value, octet)
-		numValues = new(big.Int).Mul(numValues, bigHelper)
+// alphabetIndex maps a character to its value, -1 for characters outside
+// the alphabet.
+var alphabetIndex = func() (index [256]int8) {
+	for i := range index {
+		index[i] = -1
+	}
+	for i := 0; i < len(alphabet); i++ {
+		index[alphabet[i]] = int8(i)
 	}
+	return
+}()
 
-	characterValues := []int64{}
-	for numValues.Cmp(bigZero) > 0 {
-		mod := new(big.Int)
-		value.DivMod(value, bigRadix, mod)
-		characterValues = append(characterValues, mod.Int64())
-		numValues = numValues.Div(numValues, bigRadix)
+var (
+	// ErrInvalidCharacter matches every InvalidCharacterError.
+	ErrInvalidCharacter = errors.New("Invalid base58 character")
+	// ErrInvalidCodeLength is returned for digests and codes of a length
+	// that can not be encoded or decoded.
+	ErrInvalidCodeLength = errors.New("Invalid code length")
+	// ErrUnknownHeader is returned by packages interpreting the header
+	// byte of components for headers they do not know.
+	ErrUnknownHeader = errors.New("Unknown component header")
+)
+
+// InvalidCharacterError reports a character outside the alphabet.
+type InvalidCharacterError struct {
+	Char     byte
+	Position int
+}
+
+func (e *InvalidCharacterError) Error() string {
+	return fmt.Sprintf("Invalid base58 character %q at position %d", e.Char, e.Position)
+}
+
+func (e *InvalidCharacterError) Is(target error) bool {
+	return target == ErrInvalidCharacter
+}
+
+// Encode encodes a byte slice to a modified base58 string. Digests of a
+// multiple of 9 bytes are encoded as a sequence of ISCC components with
+// separately encoded header bytes, all other lengths as a single block.
+// Block lengths whose encoding would be read back as components are
+// rejected, EncodeBlock encodes them.
+func Encode(digest []byte) (string, error) {
+	if len(digest) == 0 {
+		return "", errors.Wrap(ErrInvalidCodeLength, "Cannot encode empty digest")
 	}
-	var characters []byte
-	for i := len(characterValues) - 1; i >= 0; i-- {
-		characters = append(characters, alphabet[characterValues[i]])
+	if len(digest)%COMPONENT_BYTES == 0 {
+		var code []byte
+		for i := 0; i < len(digest); i += COMPONENT_BYTES {
+			code = append(code, EncodeBlock(digest[i:i+1])...)
+			code = append(code, EncodeBlock(digest[i+1:i+COMPONENT_BYTES])...)
+		}
+		return string(code), nil
 	}
-
-	return string(characters), nil
+	if EncodedLength(len(digest))%COMPONENT_CHARS == 0 {
+		return "", errors.Wrapf(ErrInvalidCodeLength, "Digest of %d bytes is ambiguous with ISCC components, use EncodeBlock", len(digest))
+	}
+	return EncodeBlock(digest), nil
 }
 
+// Decode decodes a modified base58 string as produced by Encode. Codes of
+// a multiple of 13 chars are decoded as a sequence of ISCC components.
 func Decode(code string) ([]byte, error) {
-	n := len(code)
-	var bitLength uint8
-	switch n {
-	case 13:
-		decodedHead, err := Decode(code[:2])
+	if err := validate(code, 0); err != nil {
+		return nil, err
+	}
+	if len(code) == 0 || len(code)%COMPONENT_CHARS != 0 {
+		return DecodeBlock(code)
+	}
+	var data []byte
+	for i := 0; i < len(code); i += COMPONENT_CHARS {
+		head, err := decodeBlock(code[i:i+2], i)
 		if err != nil {
 			return nil, err
 		}
-		decodedBody, err := Decode(code[2:])
+		body, err := decodeBlock(code[i+2:i+COMPONENT_CHARS], i+2)
 		if err != nil {
 			return nil, err
 		}
-		return append(decodedHead, decodedBody...), nil
-
-	case 2:
-		bitLength = uint8(8)
-	case 11:
-		bitLength = uint8(64)
-	default:
-		return nil, errors.Errorf("Code must be 2, 11, or 13 chars. Not %d", n)
+		data = append(append(data, head...), body...)
 	}
-	value := uint64(0)
-	numvalues := uint64(1)
-	counter := 0
-	for i := n - 1; i >= 0; i-- {
-		value += byteToAlphabet[byte(code[i])] * numvalues
-		numvalues *= 58
-		counter += 1
+	return data, nil
+}
+
+// EncodedLength returns the number of chars of a block of n bytes.
+func EncodedLength(n int) int {
+	numValues := new(big.Int).Exp(bigByte, big.NewInt(int64(n)), nil)
+	return len(numValues.Text(58))
+}
+
+// EncodeBlock encodes a byte slice of any length to a fixed width base58
+// string. The width depends only on the length of the data.
+func EncodeBlock(data []byte) string {
+	// 1. Read data as big endian number
+	value := new(big.Int).SetBytes(data)
+
+	// 2. Emit digits for the full range of the data length
+	characters := make([]byte, EncodedLength(len(data)))
+	mod := new(big.Int)
+	for i := len(characters) - 1; i >= 0; i-- {
+		value.DivMod(value, bigRadix, mod)
+		characters[i] = alphabet[mod.Int64()]
+	}
+	return string(characters)
+}
+
+// DecodeBlock decodes a fixed width base58 string as produced by EncodeBlock.
+func DecodeBlock(code string) ([]byte, error) {
+	return decodeBlock(code, 0)
+}
+
+// decodeBlock decodes a block found at offset of the full code.
+func decodeBlock(code string, offset int) ([]byte, error) {
+	// 1. Determine data length from code length
+	n := int(float64(len(code)) * bytesPerChar)
+	if EncodedLength(n) != len(code) {
+		return nil, errors.Wrapf(ErrInvalidCodeLength, "%d chars", len(code))
+	}
+	if err := validate(code, offset); err != nil {
+		return nil, err
 	}
 
-	data := make([]byte, bitLength/8)
-	for i := len(data) - 1; i >= 0; i-- {
-		data[i] = byte(value % 256)
-		value /= 256
+	// 2. Accumulate digits
+	translated := make([]byte, len(code))
+	for i := 0; i < len(code); i++ {
+		translated[i] = digits[alphabetIndex[code[i]]]
 	}
-	return data, nil
+	value, _ := new(big.Int).SetString(string(translated), 58)
+
+	// 3. Reject values out of range of the data length
+	if value.BitLen() > 8*n {
+		return nil, errors.Wrapf(ErrInvalidCodeLength, "Code %q exceeds %d bytes", code, n)
+	}
+	return value.FillBytes(make([]byte, n)), nil
+}
+
+// validate checks that all chars of code are part of the alphabet.
+func validate(code string, offset int) error {
+	for i := 0; i < len(code); i++ {
+		if alphabetIndex[code[i]] < 0 {
+			return &InvalidCharacterError{code[i], offset + i}
+		}
+	}
+	return nil
 }
@@ -2,6 +2,7 @@ package cdc
 
 import (
 	"github.com/OneOfOne/xxhash"
+	"github.com/pkg/errors"
 	"io"
 )
 
@@ -72,8 +73,55 @@ const (
 	GEAR2_MAX          = 65536
 	GEAR2_MASK1 uint64 = 0x0003590703530000
 	GEAR2_MASK2 uint64 = 0x0000d90003530000
+
+	GEAR_SWITCHOVER = 100
 )
 
+// GearParams are the chunk size limits and boundary masks of one chunking stage.
+type GearParams struct {
+	Norm  int
+	Min   int
+	Max   int
+	Mask1 uint64
+	Mask2 uint64
+}
+
+// Params configure the chunking. The first Switchover chunks are cut with
+// the Gear1 parameters, all later ones with Gear2.
+type Params struct {
+	Gear1      GearParams
+	Gear2      GearParams
+	Switchover int
+}
+
+// DefaultParams are the chunking parameters of the ISCC specification.
+var DefaultParams = Params{
+	Gear1:      GearParams{GEAR1_NORM, GEAR1_MIN, GEAR1_MAX, GEAR1_MASK1, GEAR1_MASK2},
+	Gear2:      GearParams{GEAR2_NORM, GEAR2_MIN, GEAR2_MAX, GEAR2_MASK1, GEAR2_MASK2},
+	Switchover: GEAR_SWITCHOVER,
+}
+
+// Validate checks that the chunk size limits are consistent.
+func (p Params) Validate() error {
+	for _, g := range []GearParams{p.Gear1, p.Gear2} {
+		if g.Min < 1 || g.Min > g.Norm || g.Norm > g.Max {
+			return errors.Errorf("Chunk sizes must satisfy 0 < min <= norm <= max, got %d, %d, %d", g.Min, g.Norm, g.Max)
+		}
+	}
+	if p.Switchover < 0 {
+		return errors.New("Switchover must not be negative")
+	}
+	return nil
+}
+
+// stage returns the parameters for the chunk after counter chunks.
+func (p Params) stage(counter int) GearParams {
+	if counter < p.Switchover {
+		return p.Gear1
+	}
+	return p.Gear2
+}
+
 func chunkLength(data []byte, normSize, minSize, maxSize int, mask1, mask2 uint64) int {
 	dataLength := len(data)
 
@@ -103,52 +151,70 @@ func chunkLength(data []byte, normSize, minSize, maxSize int, mask1, mask2 uint6
 	return i
 }
 
-func GetHashedCDC(r io.Reader) (chunks []uint32) {
-	section := make([]byte, GEAR1_MAX)
-	r.Read(section)
-
-	boundary := 0
-
-	for counter := 0; ; counter++ {
-		if counter < 100 {
-			if len(section) < GEAR1_MAX {
-				readBuffer := make([]byte, GEAR1_MAX)
-				n, _ := r.Read(readBuffer)
-				section = append(section, readBuffer[:n]...)
-			}
-			if len(section) == 0 {
-				break
-			}
-
-			boundary = chunkLength(
-				section,
-				GEAR1_NORM,
-				GEAR1_MIN,
-				GEAR1_MAX,
-				GEAR1_MASK1,
-				GEAR1_MASK2,
-			)
-		} else {
-			if len(section) < GEAR2_MAX {
-				readBuffer := make([]byte, GEAR2_MAX)
-				n, _ := r.Read(readBuffer)
-				section = append(section, readBuffer[:n]...)
-			}
-			if len(section) == 0 {
-				break
-			}
-
-			boundary = chunkLength(
-				section,
-				GEAR2_NORM,
-				GEAR2_MIN,
-				GEAR2_MAX,
-				GEAR2_MASK1,
-				GEAR2_MASK2,
-			)
-		}
-		chunks = append(chunks, xxhash.Checksum32(section[:boundary]))
-		section = section[boundary:]
+// GetHashedCDC returns the xxHash32 features of the content defined chunks
+// of the stream. The result does not depend on how the reader splits its
+// output, read errors are returned.
+func GetHashedCDC(r io.Reader) (chunks []uint32, err error) {
+	return GetHashedCDCWithParams(r, DefaultParams)
+}
+
+func GetHashedCDCWithParams(r io.Reader, params Params) (chunks []uint32, err error) {
+	h := NewHasherWithParams(params)
+	if _, err = io.Copy(h, r); err != nil {
+		return nil, err
 	}
-	return
+	return h.Features(), nil
+}
+
+// Hasher computes the xxHash32 features of the content defined chunks of
+// the data written to it, equal to GetHashedCDC over the whole stream.
+type Hasher struct {
+	params   Params
+	section  []byte
+	features []uint32
+}
+
+func NewHasher() *Hasher {
+	return NewHasherWithParams(DefaultParams)
+}
+
+func NewHasherWithParams(params Params) *Hasher {
+	return &Hasher{params: params}
+}
+
+// Write buffers data until a full section is available for the next chunk.
+func (h *Hasher) Write(p []byte) (int, error) {
+	h.section = append(h.section, p...)
+	for len(h.section) >= h.params.stage(len(h.features)).Max {
+		h.section, h.features = nextChunk(h.section, h.features, h.params)
+	}
+	return len(p), nil
+}
+
+// Features returns the chunk features of all data written so far. The
+// buffered tail is chunked without changing the state of the Hasher.
+func (h *Hasher) Features() []uint32 {
+	features := append([]uint32(nil), h.features...)
+	section := h.section
+	for len(section) > 0 {
+		section, features = nextChunk(section, features, h.params)
+	}
+	return features
+}
+
+func (h *Hasher) Reset() {
+	h.section = nil
+	h.features = nil
+}
+
+// nextChunk cuts the next chunk from the head of section and appends its feature.
+func nextChunk(section []byte, features []uint32, params Params) ([]byte, []uint32) {
+	boundary := chunkBoundary(section, len(features), params)
+	return section[boundary:], append(features, xxhash.Checksum32(section[:boundary]))
+}
+
+// chunkBoundary returns the length of the next chunk after counter chunks.
+func chunkBoundary(section []byte, counter int, params Params) int {
+	g := params.stage(counter)
+	return chunkLength(section, g.Norm, g.Min, g.Max, g.Mask1, g.Mask2)
 }
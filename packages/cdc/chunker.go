@@ -0,0 +1,82 @@
+package cdc
+
+import (
+	"github.com/OneOfOne/xxhash"
+	"io"
+)
+
+// Chunk is a content defined chunk of a stream.
+type Chunk struct {
+	Offset int64
+	Length int
+	Data   []byte
+	// Hash is the xxHash32 of Data as used for the Data-ID
+	Hash uint32
+}
+
+// Chunker splits a stream into the content defined chunks of the Data-ID.
+type Chunker struct {
+	r      io.Reader
+	params Params
+	// buf is the read buffer, buf[start:end] is not chunked yet
+	buf        []byte
+	start, end int
+	offset     int64
+	counter    int
+	err        error
+}
+
+func NewChunker(r io.Reader) *Chunker {
+	return NewChunkerWithParams(r, DefaultParams)
+}
+
+func NewChunkerWithParams(r io.Reader, params Params) *Chunker {
+	return &Chunker{r: r, params: params}
+}
+
+// Next returns the next chunk. It returns io.EOF after the last chunk.
+// The Data of returned chunks is not modified by later calls.
+func (c *Chunker) Next() (Chunk, error) {
+	// 1. Fill the section up to the maximum chunk size. The buffer holds two
+	// sections, so the remainder is moved to its start only occasionally.
+	size := c.params.stage(c.counter).Max
+	if c.end-c.start < size && c.err == nil {
+		if c.start+size > len(c.buf) {
+			buf := c.buf
+			if len(buf) < 2*size {
+				buf = make([]byte, 2*size)
+			}
+			c.end = copy(buf, c.buf[c.start:c.end])
+			c.start = 0
+			c.buf = buf
+		}
+		n, err := io.ReadFull(c.r, c.buf[c.end:c.start+size])
+		c.end += n
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			c.err = io.EOF
+		} else if err != nil {
+			c.err = err
+		}
+	}
+	if c.err != nil && c.err != io.EOF {
+		return Chunk{}, c.err
+	}
+	if c.start == c.end {
+		return Chunk{}, io.EOF
+	}
+
+	// 2. Cut the chunk and copy it out of the read buffer
+	section := c.buf[c.start:c.end]
+	boundary := chunkBoundary(section, c.counter, c.params)
+	data := append([]byte(nil), section[:boundary]...)
+	chunk := Chunk{
+		Offset: c.offset,
+		Length: boundary,
+		Data:   data,
+		Hash:   xxhash.Checksum32(data),
+	}
+	c.start += boundary
+	c.offset += int64(boundary)
+	c.counter++
+	return chunk, nil
+}
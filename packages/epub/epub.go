@@ -0,0 +1,152 @@
+// Package epub reads the metadata, text and images of EPUB publications.
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"github.com/coblo/iscc-golang/packages/htmltext"
+	"github.com/pkg/errors"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const (
+	MEDIA_TYPE     = "application/epub+zip"
+	CONTAINER_PATH = "META-INF/container.xml"
+)
+
+// Book is an opened EPUB publication.
+type Book struct {
+	Title    string
+	Creators []string
+	// Spine lists the paths of the content documents in reading order.
+	Spine []string
+	// Images lists the paths of the images of the manifest.
+	Images []string
+
+	archive *zip.Reader
+}
+
+type container struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type packageDocument struct {
+	Titles   []string `xml:"metadata>title"`
+	Creators []string `xml:"metadata>creator"`
+	Items    []struct {
+		Id        string `xml:"id,attr"`
+		Href      string `xml:"href,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"manifest>item"`
+	Itemrefs []struct {
+		Idref  string `xml:"idref,attr"`
+		Linear string `xml:"linear,attr"`
+	} `xml:"spine>itemref"`
+}
+
+// IsEPUB reports whether the head of a file is the head of an EPUB
+// container, a zip archive starting with the uncompressed mimetype file.
+func IsEPUB(head []byte) bool {
+	return len(head) >= 58 &&
+		bytes.HasPrefix(head, []byte("PK\x03\x04")) &&
+		string(head[30:38]) == "mimetype" &&
+		string(head[38:58]) == MEDIA_TYPE
+}
+
+// Open reads the package document of the EPUB of size bytes in r.
+func Open(r io.ReaderAt, size int64) (*Book, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	book := &Book{archive: archive}
+
+	// 1. Locate package document
+	var c container
+	if err := book.decodeXML(CONTAINER_PATH, &c); err != nil {
+		return nil, err
+	}
+	if len(c.Rootfiles) == 0 {
+		return nil, errors.New("Container lists no package document")
+	}
+	opfPath := c.Rootfiles[0].FullPath
+
+	// 2. Read metadata
+	var opf packageDocument
+	if err := book.decodeXML(opfPath, &opf); err != nil {
+		return nil, err
+	}
+	if len(opf.Titles) > 0 {
+		book.Title = strings.TrimSpace(opf.Titles[0])
+	}
+	for _, creator := range opf.Creators {
+		book.Creators = append(book.Creators, strings.TrimSpace(creator))
+	}
+
+	// 3. Resolve manifest paths relative to the package document
+	paths := make(map[string]string)
+	for _, item := range opf.Items {
+		href, err := url.PathUnescape(item.Href)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Manifest item %s", item.Id)
+		}
+		paths[item.Id] = path.Join(path.Dir(opfPath), href)
+		if strings.HasPrefix(item.MediaType, "image/") {
+			book.Images = append(book.Images, paths[item.Id])
+		}
+	}
+
+	// 4. Collect linear spine documents
+	for _, itemref := range opf.Itemrefs {
+		if itemref.Linear == "no" {
+			continue
+		}
+		p, ok := paths[itemref.Idref]
+		if !ok {
+			return nil, errors.Errorf("Spine references unknown item %s", itemref.Idref)
+		}
+		book.Spine = append(book.Spine, p)
+	}
+	return book, nil
+}
+
+// Open opens a file of the publication.
+func (b *Book) Open(name string) (io.ReadCloser, error) {
+	return b.archive.Open(name)
+}
+
+// Text returns the text of the spine documents in reading order,
+// separated by newlines.
+func (b *Book) Text() (string, error) {
+	texts := make([]string, 0, len(b.Spine))
+	for _, name := range b.Spine {
+		file, err := b.Open(name)
+		if err != nil {
+			return "", err
+		}
+		text, _, err := htmltext.Extract(file)
+		file.Close()
+		if err != nil {
+			return "", errors.Wrap(err, name)
+		}
+		if text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+func (b *Book) decodeXML(name string, v interface{}) error {
+	file, err := b.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return errors.Wrap(xml.NewDecoder(file).Decode(v), name)
+}
@@ -0,0 +1,157 @@
+package hashes
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+const (
+	CHROMA_BINS     = 12
+	CHROMA_MIN_FREQ = 28.0
+	CHROMA_MAX_FREQ = 3520.0
+	CHROMA_REF_FREQ = 440.0
+	CHROMA_TOP      = 3
+
+	// Sample rates must resolve CHROMA_MAX_FREQ and keep analysis frames small.
+	CHROMA_MIN_SAMPLE_RATE = 8000
+	CHROMA_MAX_SAMPLE_RATE = 384000
+)
+
+// ChromaFeatures creates one 32-bit feature per analysis frame of a mono
+// signal. Each feature encodes the strongest pitch classes of the frame and
+// of its predecessor, so features capture the harmonic progression. Sample
+// rates outside of CHROMA_MIN_SAMPLE_RATE to CHROMA_MAX_SAMPLE_RATE yield
+// no features.
+func ChromaFeatures(samples []float64, sampleRate int) []uint32 {
+	if sampleRate < CHROMA_MIN_SAMPLE_RATE || sampleRate > CHROMA_MAX_SAMPLE_RATE {
+		return nil
+	}
+
+	// 1. Frame size of ~190ms rounded up to a power of two, 75% overlap
+	frameSize := 1
+	for frameSize < sampleRate/6 {
+		frameSize <<= 1
+	}
+	hopSize := frameSize / 4
+	if len(samples) < frameSize {
+		return nil
+	}
+
+	window := make([]float64, frameSize)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(frameSize-1))
+	}
+
+	var features []uint32
+	var previous []float64
+	for start := 0; start+frameSize <= len(samples); start += hopSize {
+		// 2. Windowed power spectrum
+		frame := make([]complex128, frameSize)
+		for i := range frame {
+			frame[i] = complex(samples[start+i]*window[i], 0)
+		}
+		spectrum := fft(frame)
+
+		// 3. Fold spectrum to pitch classes
+		chroma := make([]float64, CHROMA_BINS)
+		for k := 1; k < frameSize/2; k++ {
+			freq := float64(k) * float64(sampleRate) / float64(frameSize)
+			if freq < CHROMA_MIN_FREQ || freq > CHROMA_MAX_FREQ {
+				continue
+			}
+			pitch := int(math.Floor(CHROMA_BINS*math.Log2(freq/CHROMA_REF_FREQ)+0.5)) % CHROMA_BINS
+			if pitch < 0 {
+				pitch += CHROMA_BINS
+			}
+			power := cmplx.Abs(spectrum[k])
+			chroma[pitch] += power * power
+		}
+		normalizeChroma(chroma)
+
+		// 4. Quantize to 32-bit feature
+		if previous != nil {
+			features = append(features, chromaFeature(chroma, previous))
+		}
+		previous = chroma
+	}
+	return features
+}
+
+func normalizeChroma(chroma []float64) {
+	norm := 0.0
+	for _, value := range chroma {
+		norm += value * value
+	}
+	norm = math.Sqrt(norm)
+	if norm == 0 {
+		return
+	}
+	for i := range chroma {
+		chroma[i] /= norm
+	}
+}
+
+func chromaFeature(chroma, previous []float64) uint32 {
+	// three strongest pitch classes of the previous and the current frame
+	// in 4 bits each. The upper 8 bits stay zero: features only identify
+	// chroma transitions for the minimum hash, which permutes all 32 bits,
+	// so the unused bits do not reduce the resolution of the digest.
+	var feature uint32
+	for i, pitch := range append(topPitches(previous), topPitches(chroma)...) {
+		feature |= uint32(pitch) << uint(4*i)
+	}
+	return feature
+}
+
+func topPitches(chroma []float64) []int {
+	top := make([]int, 0, CHROMA_TOP)
+	for len(top) < CHROMA_TOP {
+		best := -1
+		for i, value := range chroma {
+			taken := false
+			for _, t := range top {
+				taken = taken || t == i
+			}
+			if !taken && (best < 0 || value > chroma[best]) {
+				best = i
+			}
+		}
+		top = append(top, best)
+	}
+	return top
+}
+
+// fft is an iterative radix-2 Cooley-Tukey transform. The input length
+// must be a power of two.
+func fft(input []complex128) []complex128 {
+	n := len(input)
+	output := make([]complex128, n)
+
+	// bit reversal permutation
+	bitsCount := uint(0)
+	for (1 << bitsCount) < n {
+		bitsCount++
+	}
+	for i := range input {
+		reversed := 0
+		for b := uint(0); b < bitsCount; b++ {
+			reversed |= ((i >> b) & 1) << (bitsCount - 1 - b)
+		}
+		output[reversed] = input[i]
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				even := output[start+k]
+				odd := w * output[start+k+size/2]
+				output[start+k] = even + odd
+				output[start+k+size/2] = even - odd
+				w *= step
+			}
+		}
+	}
+	return output
+}
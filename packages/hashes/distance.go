@@ -0,0 +1,17 @@
+package hashes
+
+import (
+	"math/bits"
+)
+
+// HammingDistance returns the number of differing bits of two equally long digests.
+func HammingDistance(a, b []byte) (int, error) {
+	if len(a) != len(b) {
+		return 0, ErrInconsistentDigests
+	}
+	distance := 0
+	for i := range a {
+		distance += bits.OnesCount8(a[i] ^ b[i])
+	}
+	return distance, nil
+}
@@ -0,0 +1,16 @@
+package hashes
+
+import "github.com/pkg/errors"
+
+var (
+	// ErrInconsistentDigests is returned for digests of differing lengths.
+	ErrInconsistentDigests = errors.New("Digests lengths not consistent")
+	// ErrInvalidDigestLength is returned for digests SimilarityHash can not
+	// combine.
+	ErrInvalidDigestLength = errors.New("Digests must be 1 to 8 bytes long")
+	// ErrEmptyInput is returned if there is nothing to hash.
+	ErrEmptyInput = errors.New("Empty input")
+	// ErrInvalidSampleRate is returned for sample rates outside of
+	// CHROMA_MIN_SAMPLE_RATE to CHROMA_MAX_SAMPLE_RATE.
+	ErrInvalidSampleRate = errors.New("Sample rate out of range")
+)
@@ -1,17 +1,20 @@
 package hashes
 
-import (
-	"encoding/binary"
-	"errors"
-)
+import "encoding/binary"
 
 func SimilarityHash(hashDigests [][]byte) ([]byte, error) {
+	if len(hashDigests) == 0 {
+		return nil, ErrEmptyInput
+	}
 	nBytes := len(hashDigests[0])
+	if nBytes == 0 || nBytes > 8 {
+		return nil, ErrInvalidDigestLength
+	}
 	nBits := uint(nBytes * 8)
 	vector := make([]uint64, nBits)
 	for _, digest := range hashDigests {
 		if len(digest) != nBytes {
-			return nil, errors.New("Digests lengths not consistent")
+			return nil, ErrInconsistentDigests
 		}
 
 		// pad digest
@@ -0,0 +1,125 @@
+// Package htmltext extracts the readable text of HTML documents.
+package htmltext
+
+import (
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"io"
+	"strings"
+)
+
+// skipped elements hold no readable content or navigation boilerplate.
+var skipped = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Noscript: true,
+	atom.Template: true, atom.Iframe: true, atom.Svg: true, atom.Math: true,
+	atom.Nav: true, atom.Header: true, atom.Footer: true, atom.Aside: true,
+	atom.Form: true, atom.Button: true, atom.Select: true, atom.Textarea: true,
+}
+
+// skippedRoles are ARIA landmark roles of navigation boilerplate.
+var skippedRoles = map[string]bool{
+	"navigation": true, "banner": true, "contentinfo": true, "complementary": true,
+	"search": true, "menu": true, "menubar": true,
+}
+
+// blocks are elements that start a new line.
+var blocks = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Blockquote: true, atom.Br: true,
+	atom.Caption: true, atom.Dd: true, atom.Details: true, atom.Dialog: true,
+	atom.Div: true, atom.Dl: true, atom.Dt: true, atom.Fieldset: true,
+	atom.Figcaption: true, atom.Figure: true, atom.H1: true, atom.H2: true,
+	atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true, atom.Hr: true,
+	atom.Li: true, atom.Main: true, atom.Ol: true, atom.P: true, atom.Pre: true,
+	atom.Section: true, atom.Summary: true, atom.Table: true, atom.Td: true,
+	atom.Th: true, atom.Tr: true, atom.Ul: true, atom.Body: true,
+}
+
+// Extract returns the readable text of an HTML document and its title.
+// Text of block-level elements is separated by newlines, whitespace within
+// a block is collapsed to single spaces.
+func Extract(r io.Reader) (text, title string, err error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", "", err
+	}
+	title = collapse(findTitle(doc))
+
+	// 1. Collect text of visible content elements
+	var lines []string
+	var line strings.Builder
+	endLine := func() {
+		if s := collapse(line.String()); s != "" {
+			lines = append(lines, s)
+		}
+		line.Reset()
+	}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			line.WriteString(n.Data)
+			return
+		case html.ElementNode:
+			if isSkipped(n) {
+				return
+			}
+			if blocks[n.DataAtom] {
+				endLine()
+				defer endLine()
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	endLine()
+
+	// 2. Join blocks by newlines
+	return strings.Join(lines, "\n"), title, nil
+}
+
+// findTitle returns the text of the first title element.
+func findTitle(n *html.Node) string {
+	if n.Type == html.ElementNode && n.DataAtom == atom.Title {
+		var title strings.Builder
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.TextNode {
+				title.WriteString(c.Data)
+			}
+		}
+		return title.String()
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if title := findTitle(c); title != "" {
+			return title
+		}
+	}
+	return ""
+}
+
+func isSkipped(n *html.Node) bool {
+	if skipped[n.DataAtom] {
+		return true
+	}
+	for _, attr := range n.Attr {
+		switch attr.Key {
+		case "hidden":
+			return true
+		case "aria-hidden":
+			if attr.Val == "true" {
+				return true
+			}
+		case "role":
+			if skippedRoles[strings.ToLower(attr.Val)] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// collapse replaces runs of whitespace by single spaces.
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,144 @@
+package index
+
+import (
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+// Match is a single query result. IDs of matches are copies which stay
+// valid after the Store is closed.
+type Match struct {
+	ID       string
+	Distance int
+}
+
+// bkTree is a Burkhard-Keller tree over 64-bit component bodies using the
+// Hamming distance as metric.
+type bkTree struct {
+	root *bkNode
+	size int
+}
+
+type bkNode struct {
+	key      uint64
+	ids      []string
+	children map[int]*bkNode
+}
+
+func distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+func (t *bkTree) add(key uint64, id string) {
+	t.size++
+	if t.root == nil {
+		t.root = &bkNode{key: key, ids: []string{id}}
+		return
+	}
+	node := t.root
+	for {
+		d := distance(node.key, key)
+		if d == 0 {
+			node.ids = append(node.ids, id)
+			return
+		}
+		child, ok := node.children[d]
+		if !ok {
+			if node.children == nil {
+				node.children = make(map[int]*bkNode)
+			}
+			node.children[d] = &bkNode{key: key, ids: []string{id}}
+			return
+		}
+		node = child
+	}
+}
+
+// remove drops id from the node with the given key. Emptied nodes stay in
+// the tree as routing nodes.
+func (t *bkTree) remove(key uint64, id string) {
+	node := t.root
+	for node != nil {
+		d := distance(node.key, key)
+		if d == 0 {
+			for i, existing := range node.ids {
+				if existing == id {
+					node.ids = append(node.ids[:i], node.ids[i+1:]...)
+					t.size--
+					return
+				}
+			}
+			return
+		}
+		node = node.children[d]
+	}
+}
+
+// within collects all ids with a key in Hamming radius of the query.
+func (t *bkTree) within(key uint64, radius int) []Match {
+	var matches []Match
+	if t.root == nil {
+		return matches
+	}
+	stack := []*bkNode{t.root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		d := distance(node.key, key)
+		if d <= radius {
+			for _, id := range node.ids {
+				matches = append(matches, Match{strings.Clone(id), d})
+			}
+		}
+		// triangle inequality limits the subtrees to visit
+		for childDistance, child := range node.children {
+			if childDistance >= d-radius && childDistance <= d+radius {
+				stack = append(stack, child)
+			}
+		}
+	}
+	sortMatches(matches)
+	return matches
+}
+
+// nearest collects the k ids closest to the query.
+func (t *bkTree) nearest(key uint64, k int) []Match {
+	var matches []Match
+	if t.root == nil || k <= 0 {
+		return matches
+	}
+	radius := 64
+	var search func(node *bkNode)
+	search = func(node *bkNode) {
+		d := distance(node.key, key)
+		if d <= radius {
+			for _, id := range node.ids {
+				matches = append(matches, Match{strings.Clone(id), d})
+			}
+			if len(matches) >= k {
+				sortMatches(matches)
+				matches = matches[:k]
+				radius = matches[k-1].Distance
+			}
+		}
+		for childDistance, child := range node.children {
+			if childDistance >= d-radius && childDistance <= d+radius {
+				search(child)
+			}
+		}
+	}
+	search(t.root)
+	sortMatches(matches)
+	return matches
+}
+
+func sortMatches(matches []Match) {
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Distance != matches[j].Distance {
+			return matches[i].Distance < matches[j].Distance
+		}
+		return matches[i].ID < matches[j].ID
+	})
+}
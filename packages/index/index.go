@@ -0,0 +1,291 @@
+package index
+
+import (
+	"encoding/binary"
+	"github.com/coblo/iscc-golang/packages/base58"
+	"github.com/pkg/errors"
+	"strings"
+	"sync"
+)
+
+// Component kinds by header byte.
+const (
+	KIND_META     = 0x00
+	KIND_CONTENT  = 0x10
+	KIND_DATA     = 0x20
+	KIND_INSTANCE = 0x30
+)
+
+// Entry is a decoded component stored for an ID.
+type Entry struct {
+	Header byte
+	Body   uint64
+}
+
+// Index stores ISCC components keyed by an application ID. Meta-, Content-
+// and Data-IDs are searchable by Hamming distance, Instance-IDs by exact
+// match. Content-IDs of different generic media types are kept apart.
+type Index struct {
+	mu       sync.RWMutex
+	meta     bkTree
+	content  map[byte]*bkTree
+	data     bkTree
+	instance map[uint64][]string
+	entries  map[string][]Entry
+	// base serves the entries of a memory-mapped snapshot. IDs of base
+	// changed since are shadowed and kept in entries.
+	base     *snapshot
+	shadowed map[string]bool
+}
+
+func New() *Index {
+	return &Index{
+		content:  make(map[byte]*bkTree),
+		instance: make(map[uint64][]string),
+		entries:  make(map[string][]Entry),
+		shadowed: make(map[string]bool),
+	}
+}
+
+// DecodeComponent decodes an encoded 13 char component into its header and body.
+func DecodeComponent(component string) (Entry, error) {
+	if len(component) != base58.COMPONENT_CHARS {
+		return Entry{}, errors.Wrap(base58.ErrInvalidCodeLength, "Only full components with header can be indexed")
+	}
+	digest, err := base58.Decode(component)
+	if err != nil {
+		return Entry{}, err
+	}
+	return Entry{digest[0], binary.BigEndian.Uint64(digest[1:])}, nil
+}
+
+// Add indexes the encoded components for the ID.
+func (idx *Index) Add(id string, components ...string) error {
+	entries := make([]Entry, len(components))
+	for i, component := range components {
+		entry, err := DecodeComponent(component)
+		if err != nil {
+			return err
+		}
+		if _, err := kind(entry.Header); err != nil {
+			return err
+		}
+		entries[i] = entry
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for _, entry := range entries {
+		idx.addEntry(id, entry)
+	}
+	return nil
+}
+
+// AddEntries indexes already decoded components for the ID.
+func (idx *Index) AddEntries(id string, entries ...Entry) error {
+	for _, entry := range entries {
+		if _, err := kind(entry.Header); err != nil {
+			return err
+		}
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for _, entry := range entries {
+		idx.addEntry(id, entry)
+	}
+	return nil
+}
+
+func (idx *Index) addEntry(id string, entry Entry) {
+	idx.shadow(id)
+	idx.addToTree(id, entry)
+	idx.entries[id] = append(idx.entries[id], entry)
+}
+
+func (idx *Index) addToTree(id string, entry Entry) {
+	k, _ := kind(entry.Header)
+	switch k {
+	case KIND_META:
+		idx.meta.add(entry.Body, id)
+	case KIND_CONTENT:
+		tree, ok := idx.content[entry.Header&^1]
+		if !ok {
+			tree = &bkTree{}
+			idx.content[entry.Header&^1] = tree
+		}
+		tree.add(entry.Body, id)
+	case KIND_DATA:
+		idx.data.add(entry.Body, id)
+	case KIND_INSTANCE:
+		idx.instance[entry.Body] = append(idx.instance[entry.Body], id)
+	}
+}
+
+// shadow moves the entries of an ID of the snapshot to entries before
+// they change.
+func (idx *Index) shadow(id string) {
+	if idx.base == nil || idx.shadowed[id] {
+		return
+	}
+	if entries, ok := idx.base.find(id); ok {
+		idx.entries[id] = entries
+		idx.shadowed[id] = true
+	}
+}
+
+// lookup returns the entries of the ID from entries or the snapshot.
+func (idx *Index) lookup(id string) []Entry {
+	if entries, ok := idx.entries[id]; ok || idx.base == nil || idx.shadowed[id] {
+		return entries
+	}
+	entries, _ := idx.base.find(id)
+	return entries
+}
+
+// Remove drops all components of the ID.
+func (idx *Index) Remove(id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.shadow(id)
+	for _, entry := range idx.entries[id] {
+		k, _ := kind(entry.Header)
+		switch k {
+		case KIND_META:
+			idx.meta.remove(entry.Body, id)
+		case KIND_CONTENT:
+			idx.content[entry.Header&^1].remove(entry.Body, id)
+		case KIND_DATA:
+			idx.data.remove(entry.Body, id)
+		case KIND_INSTANCE:
+			ids := idx.instance[entry.Body]
+			for i, existing := range ids {
+				if existing == id {
+					ids = append(ids[:i], ids[i+1:]...)
+					break
+				}
+			}
+			if len(ids) == 0 {
+				delete(idx.instance, entry.Body)
+			} else {
+				idx.instance[entry.Body] = ids
+			}
+		}
+	}
+	delete(idx.entries, id)
+}
+
+// Entries returns the decoded components stored for the ID.
+func (idx *Index) Entries(id string) []Entry {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return append([]Entry(nil), idx.lookup(id)...)
+}
+
+// Len returns the number of indexed IDs.
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if idx.base == nil {
+		return len(idx.entries)
+	}
+	return len(idx.entries) + idx.base.count - len(idx.shadowed)
+}
+
+// Within returns all IDs with a component of the same kind within the
+// Hamming radius of the query component, closest first. Instance-IDs only
+// match exactly.
+func (idx *Index) Within(component string, radius int) ([]Match, error) {
+	entry, err := DecodeComponent(component)
+	if err != nil {
+		return nil, err
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	tree, err := idx.tree(entry.Header)
+	if err != nil {
+		return nil, err
+	}
+	if tree == nil {
+		return idx.exact(entry.Body), nil
+	}
+	return tree.within(entry.Body, radius), nil
+}
+
+// Nearest returns the k IDs with the closest components of the same kind.
+// Instance-IDs only match exactly.
+func (idx *Index) Nearest(component string, k int) ([]Match, error) {
+	entry, err := DecodeComponent(component)
+	if err != nil {
+		return nil, err
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	tree, err := idx.tree(entry.Header)
+	if err != nil {
+		return nil, err
+	}
+	if tree == nil {
+		return idx.exact(entry.Body), nil
+	}
+	return tree.nearest(entry.Body, k), nil
+}
+
+// Lookup returns the IDs registered with exactly this Instance-ID.
+func (idx *Index) Lookup(iid string) ([]string, error) {
+	entry, err := DecodeComponent(iid)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Header != KIND_INSTANCE {
+		return nil, errors.Wrapf(base58.ErrUnknownHeader, "Expected Instance-ID header, got 0x%02x", entry.Header)
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	ids := make([]string, 0, len(idx.instance[entry.Body]))
+	for _, id := range idx.instance[entry.Body] {
+		ids = append(ids, strings.Clone(id))
+	}
+	return ids, nil
+}
+
+// tree returns the search tree for the header, nil for Instance-IDs.
+func (idx *Index) tree(header byte) (*bkTree, error) {
+	k, err := kind(header)
+	if err != nil {
+		return nil, err
+	}
+	switch k {
+	case KIND_META:
+		return &idx.meta, nil
+	case KIND_CONTENT:
+		if tree, ok := idx.content[header&^1]; ok {
+			return tree, nil
+		}
+		return &bkTree{}, nil
+	case KIND_DATA:
+		return &idx.data, nil
+	}
+	return nil, nil
+}
+
+func (idx *Index) exact(body uint64) []Match {
+	var matches []Match
+	for _, id := range idx.instance[body] {
+		matches = append(matches, Match{strings.Clone(id), 0})
+	}
+	sortMatches(matches)
+	return matches
+}
+
+func kind(header byte) (byte, error) {
+	switch {
+	case header == KIND_META, header == KIND_DATA, header == KIND_INSTANCE:
+		return header, nil
+	case header >= 0x10 && header <= 0x19:
+		return KIND_CONTENT, nil
+	}
+	return 0, errors.Wrapf(base58.ErrUnknownHeader, "Header 0x%02x", header)
+}
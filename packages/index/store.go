@@ -0,0 +1,557 @@
+package index
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"github.com/pkg/errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+const (
+	SNAPSHOT_FILE  = "snapshot"
+	SNAPSHOT_MAGIC = "ISCCIDX2"
+	LOG_PREFIX     = "log."
+
+	OP_ADD    byte = 1
+	OP_REMOVE byte = 2
+
+	ENTRY_SIZE = 9
+	// RECORD_HEADER_SIZE is the length of a log record body followed by
+	// its CRC32 checksum.
+	RECORD_HEADER_SIZE = 8
+)
+
+// ErrClosed is returned by the methods of a closed Store.
+var ErrClosed = errors.New("Store is closed")
+
+// Store is an Index persisted in a directory. Every change is appended to
+// a write ahead log and synced before it is applied. Snapshot compacts the
+// log into a snapshot file that is memory-mapped on Open. Only the search
+// trees and their IDs are built in memory, the entries of the snapshot are
+// read from the mapping until Close.
+//
+// Snapshot and log files are numbered by a generation. A snapshot of
+// generation N contains all changes of the logs before N, so on Open only
+// logs of generation N and later are replayed. This keeps every step of
+// Snapshot crash-safe.
+type Store struct {
+	mu         sync.Mutex
+	dir        string
+	index      *Index
+	log        *os.File
+	generation uint64
+	release    func()
+	closed     atomic.Bool
+}
+
+// Open loads the snapshot and replays the logs in dir, creating the
+// directory if needed.
+func Open(dir string) (store *Store, err error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &Store{dir: dir, index: New()}
+
+	// 1. Load snapshot
+	generation, release, err := loadSnapshot(filepath.Join(dir, SNAPSHOT_FILE), s.index)
+	if err != nil {
+		return nil, err
+	}
+	s.generation, s.release = generation, release
+	defer func() {
+		if err != nil {
+			s.release()
+		}
+	}()
+
+	// 2. Replay logs of the snapshot generation and later, drop older ones
+	generations, err := logGenerations(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range generations {
+		if g < generation {
+			if err := os.Remove(s.logPath(g)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := replayLog(s.logPath(g), s.index); err != nil {
+			return nil, err
+		}
+		s.generation = g
+	}
+
+	// 3. Continue appending to the latest log
+	s.log, err = os.OpenFile(s.logPath(s.generation), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Add logs and indexes the encoded components for the ID.
+func (s *Store) Add(id string, components ...string) error {
+	entries := make([]Entry, len(components))
+	for i, component := range components {
+		entry, err := DecodeComponent(component)
+		if err != nil {
+			return err
+		}
+		if _, err := kind(entry.Header); err != nil {
+			return err
+		}
+		entries[i] = entry
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed.Load() {
+		return ErrClosed
+	}
+	if len(s.index.Entries(id))+len(entries) > 0xff {
+		return errors.New("Too many components for one ID")
+	}
+	if err := s.append(OP_ADD, id, entries); err != nil {
+		return err
+	}
+	return s.index.AddEntries(id, entries...)
+}
+
+// Remove logs and drops all components of the ID.
+func (s *Store) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed.Load() {
+		return ErrClosed
+	}
+	if err := s.append(OP_REMOVE, id, nil); err != nil {
+		return err
+	}
+	s.index.Remove(id)
+	return nil
+}
+
+func (s *Store) Within(component string, radius int) ([]Match, error) {
+	if s.closed.Load() {
+		return nil, ErrClosed
+	}
+	return s.index.Within(component, radius)
+}
+
+func (s *Store) Nearest(component string, k int) ([]Match, error) {
+	if s.closed.Load() {
+		return nil, ErrClosed
+	}
+	return s.index.Nearest(component, k)
+}
+
+func (s *Store) Lookup(iid string) ([]string, error) {
+	if s.closed.Load() {
+		return nil, ErrClosed
+	}
+	return s.index.Lookup(iid)
+}
+
+// Entries returns the decoded components stored for the ID, nil once the
+// store is closed.
+func (s *Store) Entries(id string) []Entry {
+	if s.closed.Load() {
+		return nil
+	}
+	return s.index.Entries(id)
+}
+
+// Len returns the number of indexed IDs, 0 once the store is closed.
+func (s *Store) Len() int {
+	if s.closed.Load() {
+		return 0
+	}
+	return s.index.Len()
+}
+
+// Snapshot writes the complete index to a new snapshot and starts a new
+// log. Writes are blocked while the snapshot is written.
+func (s *Store) Snapshot() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed.Load() {
+		return ErrClosed
+	}
+
+	// 1. Start the log of the next generation
+	generation := s.generation + 1
+	log, err := os.OpenFile(s.logPath(generation), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if err := syncDir(s.dir); err != nil {
+		log.Close()
+		return err
+	}
+	s.log.Close()
+	s.log = log
+	s.generation = generation
+
+	// 2. Write snapshot to a temporary file and atomically replace the old one
+	tmp := filepath.Join(s.dir, SNAPSHOT_FILE+".tmp")
+	if err := writeSnapshot(tmp, generation, s.index); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, SNAPSHOT_FILE)); err != nil {
+		return err
+	}
+	if err := syncDir(s.dir); err != nil {
+		return err
+	}
+
+	// 3. Logs contained in the snapshot are obsolete
+	generations, err := logGenerations(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, g := range generations {
+		if g < generation {
+			if err := os.Remove(s.logPath(g)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close closes the log and unmaps the snapshot. It waits for queries in
+// progress, later calls return ErrClosed.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed.Swap(true) {
+		return ErrClosed
+	}
+	err := s.log.Close()
+	s.index.mu.Lock()
+	s.index.base = nil
+	s.release()
+	s.release = func() {}
+	s.index.mu.Unlock()
+	return err
+}
+
+func (s *Store) logPath(generation uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s%016x", LOG_PREFIX, generation))
+}
+
+// append writes a log record and syncs it to disk. A record consists of
+// a header with the body length and its CRC32 checksum, the body and a
+// CRC32 checksum of the body. The body holds the operation, the length
+// prefixed ID, the entry count and the entries.
+func (s *Store) append(op byte, id string, entries []Entry) error {
+	record, err := encodeRecord(op, id, entries)
+	if err != nil {
+		return err
+	}
+	if _, err := s.log.Write(record); err != nil {
+		return err
+	}
+	return s.log.Sync()
+}
+
+func encodeRecord(op byte, id string, entries []Entry) ([]byte, error) {
+	if len(id) > 0xffff {
+		return nil, errors.New("ID must not be longer than 65535 bytes")
+	}
+	if len(entries) > 0xff {
+		return nil, errors.New("Too many components for one ID")
+	}
+	size := 1 + 2 + len(id) + 1 + len(entries)*ENTRY_SIZE
+	record := make([]byte, 0, RECORD_HEADER_SIZE+size+4)
+	record = binary.BigEndian.AppendUint32(record, uint32(size))
+	record = binary.BigEndian.AppendUint32(record, crc32.ChecksumIEEE(record))
+	record = append(record, op)
+	record = appendEntries(record, id, entries)
+	body := record[RECORD_HEADER_SIZE:]
+	return binary.BigEndian.AppendUint32(record, crc32.ChecksumIEEE(body)), nil
+}
+
+func appendEntries(buf []byte, id string, entries []Entry) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(id)))
+	buf = append(buf, id...)
+	buf = append(buf, byte(len(entries)))
+	for _, entry := range entries {
+		buf = append(buf, entry.Header)
+		buf = binary.BigEndian.AppendUint64(buf, entry.Body)
+	}
+	return buf
+}
+
+// readEntries parses an ID with its entries from the head of data and
+// returns the number of bytes consumed. The ID refers to data.
+func readEntries(data []byte) (id []byte, entries []Entry, n int, err error) {
+	if len(data) < 2 {
+		return nil, nil, 0, io.ErrUnexpectedEOF
+	}
+	idLength := int(binary.BigEndian.Uint16(data))
+	n = 2 + idLength + 1
+	if len(data) < n {
+		return nil, nil, 0, io.ErrUnexpectedEOF
+	}
+	id = data[2 : 2+idLength]
+	count := int(data[n-1])
+	if len(data) < n+count*ENTRY_SIZE {
+		return nil, nil, 0, io.ErrUnexpectedEOF
+	}
+	entries = make([]Entry, count)
+	for i := range entries {
+		entries[i] = Entry{data[n], binary.BigEndian.Uint64(data[n+1:])}
+		n += ENTRY_SIZE
+	}
+	return id, entries, n, nil
+}
+
+// replayLog applies all records of a log. A crash during append can only
+// leave a torn last record: an incomplete header, a body shorter than its
+// checksummed length or a body checksum mismatch right at the end of the
+// log. Such a tail is cut off, every other damage is an error.
+func replayLog(path string, idx *Index) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	offset := 0
+	for offset < len(data) {
+		// 1. Verify header, records extending beyond the end of the log are torn
+		record := data[offset:]
+		if len(record) < RECORD_HEADER_SIZE {
+			break
+		}
+		if crc32.ChecksumIEEE(record[:4]) != binary.BigEndian.Uint32(record[4:]) {
+			return errors.Errorf("Checksum mismatch in log record header at %s:%d", path, offset)
+		}
+		size := RECORD_HEADER_SIZE + int(binary.BigEndian.Uint32(record)) + 4
+		if len(record) < size {
+			break
+		}
+		body := record[RECORD_HEADER_SIZE : size-4]
+		if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(record[size-4:]) {
+			if size == len(record) {
+				break
+			}
+			return errors.Errorf("Checksum mismatch in log record at %s:%d", path, offset)
+		}
+
+		// 2. Apply record
+		if len(body) < 1 {
+			return errors.Errorf("Empty log record at %s:%d", path, offset)
+		}
+		id, entries, n, err := readEntries(body[1:])
+		if err != nil || 1+n != len(body) {
+			return errors.Errorf("Invalid log record at %s:%d", path, offset)
+		}
+		switch body[0] {
+		case OP_ADD:
+			if err := idx.AddEntries(string(id), entries...); err != nil {
+				return errors.Wrapf(err, "Invalid log record at %s:%d", path, offset)
+			}
+		case OP_REMOVE:
+			idx.Remove(string(id))
+		default:
+			return errors.Errorf("Unknown log operation %d at %s:%d", body[0], path, offset)
+		}
+		offset += size
+	}
+	if offset < len(data) {
+		return os.Truncate(path, int64(offset))
+	}
+	return nil
+}
+
+// writeSnapshot stores the index as magic, generation, ID count, the IDs
+// with their entries sorted by ID, the offsets of the IDs and a CRC32
+// checksum and syncs the file.
+func writeSnapshot(path string, generation uint64, idx *Index) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	checksum := crc32.NewIEEE()
+	w := bufio.NewWriter(io.MultiWriter(file, checksum))
+
+	idx.mu.RLock()
+	ids := idx.ids()
+	header := []byte(SNAPSHOT_MAGIC)
+	header = binary.BigEndian.AppendUint64(header, generation)
+	header = binary.BigEndian.AppendUint64(header, uint64(len(ids)))
+	w.Write(header)
+	offsets := make([]byte, 0, len(ids)*8)
+	offset := uint64(len(header))
+	var buf []byte
+	for _, id := range ids {
+		offsets = binary.BigEndian.AppendUint64(offsets, offset)
+		buf = appendEntries(buf[:0], id, idx.lookup(id))
+		w.Write(buf)
+		offset += uint64(len(buf))
+	}
+	idx.mu.RUnlock()
+	w.Write(offsets)
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := binary.Write(file, binary.BigEndian, checksum.Sum32()); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// ids returns all IDs of the index in order.
+func (idx *Index) ids() []string {
+	ids := make([]string, 0, len(idx.entries))
+	for id := range idx.entries {
+		ids = append(ids, id)
+	}
+	if idx.base != nil {
+		for i := 0; i < idx.base.count; i++ {
+			if id := idx.base.id(i); !idx.shadowed[id] {
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// loadSnapshot memory-maps the snapshot and builds the search trees of the
+// index from it. The index reads IDs and entries from the mapping until
+// release is called. It returns the generation of the snapshot, 0 if there
+// is none.
+func loadSnapshot(path string, idx *Index) (generation uint64, release func(), err error) {
+	data, release, err := mapFile(path)
+	if os.IsNotExist(err) {
+		return 0, func() {}, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	defer func() {
+		if err != nil {
+			release()
+		}
+	}()
+
+	// 1. Verify header and checksum
+	headerSize := len(SNAPSHOT_MAGIC) + 16
+	if len(data) < headerSize+4 || string(data[:len(SNAPSHOT_MAGIC)]) != SNAPSHOT_MAGIC {
+		return 0, nil, errors.Errorf("%s is not an index snapshot", path)
+	}
+	body := data[:len(data)-4]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(data[len(data)-4:]) {
+		return 0, nil, errors.Errorf("Checksum mismatch in %s", path)
+	}
+	generation = binary.BigEndian.Uint64(data[len(SNAPSHOT_MAGIC):])
+	count := binary.BigEndian.Uint64(data[len(SNAPSHOT_MAGIC)+8:])
+	if count > uint64(len(body)-headerSize)/8 {
+		return 0, nil, errors.Errorf("Corrupt snapshot %s: ID count %d", path, count)
+	}
+	base := &snapshot{
+		data:    body,
+		offsets: body[len(body)-int(count)*8:],
+		count:   int(count),
+	}
+
+	// 2. Validate records and index their entries
+	end := uint64(len(body) - len(base.offsets))
+	previous := ""
+	for i := 0; i < base.count; i++ {
+		offset := binary.BigEndian.Uint64(base.offsets[i*8:])
+		if offset < uint64(headerSize) || offset >= end {
+			return 0, nil, errors.Errorf("Corrupt snapshot %s: offset %d", path, offset)
+		}
+		_, entries, _, err := readEntries(body[offset:end])
+		if err != nil {
+			return 0, nil, errors.Wrapf(err, "Corrupt snapshot %s", path)
+		}
+		// Trees outlive the mapping, so they get copies of the IDs
+		id := strings.Clone(base.id(i))
+		if i > 0 && id <= previous {
+			return 0, nil, errors.Errorf("Corrupt snapshot %s: IDs out of order", path)
+		}
+		previous = id
+		for _, entry := range entries {
+			if _, err := kind(entry.Header); err != nil {
+				return 0, nil, errors.Wrapf(err, "Corrupt snapshot %s", path)
+			}
+			idx.addToTree(id, entry)
+		}
+	}
+	idx.base = base
+	return generation, release, nil
+}
+
+// snapshot serves the records of a memory-mapped snapshot. IDs returned by
+// its methods refer to the mapping.
+type snapshot struct {
+	data    []byte
+	offsets []byte
+	count   int
+}
+
+// id returns the ID of the i-th record.
+func (s *snapshot) id(i int) string {
+	record := s.data[binary.BigEndian.Uint64(s.offsets[i*8:]):]
+	id := record[2 : 2+int(binary.BigEndian.Uint16(record))]
+	return unsafe.String(unsafe.SliceData(id), len(id))
+}
+
+// find returns the entries of an ID by binary search.
+func (s *snapshot) find(id string) ([]Entry, bool) {
+	i := sort.Search(s.count, func(i int) bool { return s.id(i) >= id })
+	if i == s.count || s.id(i) != id {
+		return nil, false
+	}
+	_, entries, _, _ := readEntries(s.data[binary.BigEndian.Uint64(s.offsets[i*8:]):])
+	return entries, true
+}
+
+func logGenerations(dir string) ([]uint64, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var generations []uint64
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name(), LOG_PREFIX) {
+			continue
+		}
+		g, err := strconv.ParseUint(strings.TrimPrefix(file.Name(), LOG_PREFIX), 16, 64)
+		if err != nil {
+			continue
+		}
+		generations = append(generations, g)
+	}
+	sort.Slice(generations, func(i, j int) bool { return generations[i] < generations[j] })
+	return generations, nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
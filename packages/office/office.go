@@ -0,0 +1,387 @@
+// Package office extracts the text and metadata of OOXML (DOCX, PPTX, XLSX)
+// and ODF text (ODT) documents.
+package office
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"github.com/pkg/errors"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	FORMAT_DOCX = "docx"
+	FORMAT_PPTX = "pptx"
+	FORMAT_XLSX = "xlsx"
+	FORMAT_ODT  = "odt"
+
+	MEDIA_TYPE_DOCX = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	MEDIA_TYPE_PPTX = "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+	MEDIA_TYPE_XLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	MEDIA_TYPE_ODT  = "application/vnd.oasis.opendocument.text"
+	// MEDIA_TYPE_OOXML is detected for OOXML packages whose first entry
+	// does not tell the format.
+	MEDIA_TYPE_OOXML = "application/vnd.openxmlformats-officedocument"
+)
+
+// MediaTypes lists the media types Detect reports.
+var MediaTypes = []string{MEDIA_TYPE_DOCX, MEDIA_TYPE_PPTX, MEDIA_TYPE_XLSX, MEDIA_TYPE_ODT, MEDIA_TYPE_OOXML}
+
+// ErrUnsupportedFormat is returned by Open for zip archives of other formats.
+var ErrUnsupportedFormat = errors.New("Unsupported office document format")
+
+// Document is an opened office document.
+type Document struct {
+	Format   string
+	Title    string
+	Creators []string
+
+	archive *zip.Reader
+}
+
+// textRules describe the text of a document body by the local names of
+// its elements.
+type textRules struct {
+	// paragraphs end a line
+	paragraphs map[string]bool
+	// texts hold the character data, all character data of paragraphs is
+	// text if empty
+	texts map[string]bool
+	// breaks start a new line, tabs insert a tab and spaces insert as many
+	// spaces as their count attribute
+	breaks, tabs, spaces map[string]bool
+	// skips are left out with all their content
+	skips map[string]bool
+}
+
+func set(names ...string) map[string]bool {
+	m := make(map[string]bool, len(names))
+	for _, name := range names {
+		m[name] = true
+	}
+	return m
+}
+
+var (
+	// WordprocessingML, deleted text and field codes are skipped
+	wordRules = textRules{
+		paragraphs: set("p"),
+		texts:      set("t"),
+		breaks:     set("br", "cr"),
+		tabs:       set("tab"),
+		skips:      set("delText", "instrText", "del"),
+	}
+	// DrawingML text of slides
+	slideRules = textRules{
+		paragraphs: set("p"),
+		texts:      set("t"),
+		breaks:     set("br"),
+	}
+	// SpreadsheetML shared strings, phonetic runs are skipped
+	sharedStringRules = textRules{
+		paragraphs: set("si"),
+		texts:      set("t"),
+		skips:      set("rPh", "phoneticPr"),
+	}
+	// ODF text, notes and annotations are skipped
+	odfRules = textRules{
+		paragraphs: set("p", "h"),
+		breaks:     set("line-break"),
+		tabs:       set("tab"),
+		spaces:     set("s"),
+		skips:      set("note", "annotation", "tracked-changes"),
+	}
+)
+
+type coreProperties struct {
+	Titles   []string `xml:"title"`
+	Creators []string `xml:"creator"`
+}
+
+type odfMeta struct {
+	Titles          []string `xml:"meta>title"`
+	InitialCreators []string `xml:"meta>initial-creator"`
+	Creators        []string `xml:"meta>creator"`
+}
+
+// Detect returns the media type of the office document with the given head
+// of the file, empty if it is none. OOXML packages are told apart by the
+// name of their first entry, ODT by its uncompressed mimetype entry.
+func Detect(head []byte) string {
+	// 1. Name of the first entry of a zip archive
+	if len(head) < 30 || !bytes.HasPrefix(head, []byte("PK\x03\x04")) {
+		return ""
+	}
+	nameLength := int(binary.LittleEndian.Uint16(head[26:28]))
+	extraLength := int(binary.LittleEndian.Uint16(head[28:30]))
+	if len(head) < 30+nameLength {
+		return ""
+	}
+	name := string(head[30 : 30+nameLength])
+
+	// 2. Media type by entry
+	switch {
+	case name == "mimetype":
+		content := head[30+nameLength:]
+		if len(content) < extraLength {
+			return ""
+		}
+		if bytes.HasPrefix(content[extraLength:], []byte(MEDIA_TYPE_ODT)) {
+			return MEDIA_TYPE_ODT
+		}
+	case strings.HasPrefix(name, "word/"):
+		return MEDIA_TYPE_DOCX
+	case strings.HasPrefix(name, "ppt/"):
+		return MEDIA_TYPE_PPTX
+	case strings.HasPrefix(name, "xl/"):
+		return MEDIA_TYPE_XLSX
+	case name == "[Content_Types].xml", strings.HasPrefix(name, "_rels/"), strings.HasPrefix(name, "docProps/"):
+		return MEDIA_TYPE_OOXML
+	}
+	return ""
+}
+
+// Open detects the format of the document of size bytes in r and reads its
+// metadata. Other zip archives fail with ErrUnsupportedFormat.
+func Open(r io.ReaderAt, size int64) (*Document, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	doc := &Document{archive: archive}
+
+	// 1. Detect format from the archive entries
+	switch {
+	case doc.exists("word/document.xml"):
+		doc.Format = FORMAT_DOCX
+	case doc.exists("ppt/presentation.xml"):
+		doc.Format = FORMAT_PPTX
+	case doc.exists("xl/workbook.xml"):
+		doc.Format = FORMAT_XLSX
+	case doc.isODT():
+		doc.Format = FORMAT_ODT
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	// 2. Read title and creators from the core properties
+	var titles, creators []string
+	if doc.Format == FORMAT_ODT {
+		var meta odfMeta
+		if doc.exists("meta.xml") {
+			if err := doc.decodeXML("meta.xml", &meta); err != nil {
+				return nil, err
+			}
+		}
+		titles, creators = meta.Titles, append(meta.InitialCreators, meta.Creators...)
+	} else if doc.exists("docProps/core.xml") {
+		var core coreProperties
+		if err := doc.decodeXML("docProps/core.xml", &core); err != nil {
+			return nil, err
+		}
+		titles, creators = core.Titles, core.Creators
+	}
+	if len(titles) > 0 {
+		doc.Title = strings.TrimSpace(titles[0])
+	}
+	seen := make(map[string]bool)
+	for _, creator := range creators {
+		if creator = strings.TrimSpace(creator); creator != "" && !seen[creator] {
+			seen[creator] = true
+			doc.Creators = append(doc.Creators, creator)
+		}
+	}
+	return doc, nil
+}
+
+// Text returns the text of the document in reading order with paragraphs
+// separated by newlines. Text of spreadsheets are their shared strings.
+func (d *Document) Text() (string, error) {
+	switch d.Format {
+	case FORMAT_DOCX:
+		return d.partText("word/document.xml", wordRules)
+	case FORMAT_XLSX:
+		if !d.exists("xl/sharedStrings.xml") {
+			return "", nil
+		}
+		return d.partText("xl/sharedStrings.xml", sharedStringRules)
+	case FORMAT_ODT:
+		return d.partText("content.xml", odfRules)
+	}
+
+	// slides of presentations in presentation order
+	slides, err := d.slides()
+	if err != nil {
+		return "", err
+	}
+	texts := make([]string, 0, len(slides))
+	for _, slide := range slides {
+		text, err := d.partText(slide, slideRules)
+		if err != nil {
+			return "", err
+		}
+		if text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+type presentation struct {
+	SlideIds []struct {
+		Rid string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sldIdLst>sldId"`
+}
+
+type relationships struct {
+	Relationships []struct {
+		Id     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// slides returns the paths of the slides in presentation order.
+func (d *Document) slides() ([]string, error) {
+	var p presentation
+	if err := d.decodeXML("ppt/presentation.xml", &p); err != nil {
+		return nil, err
+	}
+	var rels relationships
+	if err := d.decodeXML("ppt/_rels/presentation.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	targets := make(map[string]string)
+	for _, rel := range rels.Relationships {
+		targets[rel.Id] = rel.Target
+	}
+	slides := make([]string, 0, len(p.SlideIds))
+	for _, id := range p.SlideIds {
+		target, ok := targets[id.Rid]
+		if !ok {
+			return nil, errors.Errorf("Presentation references unknown slide %s", id.Rid)
+		}
+		if strings.HasPrefix(target, "/") {
+			slides = append(slides, strings.TrimPrefix(target, "/"))
+		} else {
+			slides = append(slides, path.Join("ppt", target))
+		}
+	}
+	return slides, nil
+}
+
+// partText extracts the text of an XML part of the archive.
+func (d *Document) partText(name string, rules textRules) (string, error) {
+	file, err := d.archive.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var (
+		lines             []string
+		line              strings.Builder
+		paragraphs, texts int
+		skipping          int
+		decoder           = xml.NewDecoder(file)
+	)
+	endLine := func() {
+		if s := strings.TrimSpace(line.String()); s != "" {
+			lines = append(lines, s)
+		}
+		line.Reset()
+	}
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", errors.Wrap(err, name)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			local := t.Name.Local
+			switch {
+			case skipping > 0 || rules.skips[local]:
+				skipping++
+			case rules.paragraphs[local]:
+				if paragraphs == 0 {
+					endLine()
+				}
+				paragraphs++
+			case rules.texts[local]:
+				texts++
+			case rules.breaks[local]:
+				endLine()
+			case rules.tabs[local]:
+				line.WriteString("\t")
+			case rules.spaces[local]:
+				line.WriteString(strings.Repeat(" ", spaceCount(t)))
+			}
+		case xml.EndElement:
+			local := t.Name.Local
+			switch {
+			case skipping > 0:
+				skipping--
+			case rules.paragraphs[local]:
+				paragraphs--
+				if paragraphs == 0 {
+					endLine()
+				}
+			case rules.texts[local]:
+				texts--
+			}
+		case xml.CharData:
+			if skipping == 0 && (texts > 0 || len(rules.texts) == 0 && paragraphs > 0) {
+				line.Write(t)
+			}
+		}
+	}
+	endLine()
+	return strings.Join(lines, "\n"), nil
+}
+
+// spaceCount returns the number of spaces of an ODF text:s element.
+func spaceCount(t xml.StartElement) int {
+	for _, attr := range t.Attr {
+		if attr.Name.Local == "c" {
+			if n, err := strconv.Atoi(attr.Value); err == nil && n > 0 && n < 1024 {
+				return n
+			}
+		}
+	}
+	return 1
+}
+
+func (d *Document) isODT() bool {
+	file, err := d.archive.Open("mimetype")
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	mediaType, err := io.ReadAll(io.LimitReader(file, 256))
+	return err == nil && strings.TrimSpace(string(mediaType)) == MEDIA_TYPE_ODT
+}
+
+func (d *Document) exists(name string) bool {
+	for _, file := range d.archive.File {
+		if file.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Document) decodeXML(name string, v interface{}) error {
+	file, err := d.archive.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return errors.Wrap(xml.NewDecoder(file).Decode(v), name)
+}
@@ -0,0 +1,152 @@
+package wav
+
+import (
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"io"
+	"math"
+)
+
+const (
+	FORMAT_PCM        = 0x0001
+	FORMAT_FLOAT      = 0x0003
+	FORMAT_EXTENSIBLE = 0xfffe
+
+	// MAX_FMT_SIZE bounds the fmt chunk, the largest known layout
+	// WAVE_FORMAT_EXTENSIBLE has 40 bytes.
+	MAX_FMT_SIZE = 1024
+)
+
+type format struct {
+	AudioFormat   uint16
+	Channels      uint16
+	SampleRate    uint32
+	ByteRate      uint32
+	BlockAlign    uint16
+	BitsPerSample uint16
+}
+
+// Decode reads a RIFF/WAVE stream and returns its samples downmixed to a
+// single channel in the range [-1, 1] together with the sample rate.
+func Decode(r io.Reader) (samples []float64, sampleRate int, err error) {
+	// 1. Verify RIFF header
+	header := make([]byte, 12)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return nil, 0, errors.Wrap(err, "Reading RIFF header failed")
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return nil, 0, errors.New("Not a RIFF/WAVE stream")
+	}
+
+	// 2. Walk chunks until the data chunk
+	var fmtChunk *format
+	chunkHeader := make([]byte, 8)
+	for {
+		if _, err = io.ReadFull(r, chunkHeader); err != nil {
+			return nil, 0, errors.Wrap(err, "Missing data chunk")
+		}
+		id := string(chunkHeader[:4])
+		size := int64(binary.LittleEndian.Uint32(chunkHeader[4:]))
+
+		switch id {
+		case "fmt ":
+			if size > MAX_FMT_SIZE {
+				return nil, 0, errors.Errorf("fmt chunk of %d bytes exceeds %d bytes", size, MAX_FMT_SIZE)
+			}
+			body := make([]byte, size+size%2)
+			if _, err = io.ReadFull(r, body); err != nil {
+				return nil, 0, errors.Wrap(err, "Reading fmt chunk failed")
+			}
+			if fmtChunk, err = parseFormat(body); err != nil {
+				return nil, 0, err
+			}
+		case "data":
+			if fmtChunk == nil {
+				return nil, 0, errors.New("Data chunk before fmt chunk")
+			}
+			samples, err = decodeSamples(io.LimitReader(r, size), fmtChunk)
+			return samples, int(fmtChunk.SampleRate), err
+		default:
+			if _, err = io.CopyN(io.Discard, r, size+size%2); err != nil {
+				return nil, 0, errors.Wrapf(err, "Skipping %q chunk failed", id)
+			}
+		}
+	}
+}
+
+func parseFormat(body []byte) (*format, error) {
+	if len(body) < 16 {
+		return nil, errors.New("fmt chunk too short")
+	}
+	f := &format{
+		AudioFormat:   binary.LittleEndian.Uint16(body[0:2]),
+		Channels:      binary.LittleEndian.Uint16(body[2:4]),
+		SampleRate:    binary.LittleEndian.Uint32(body[4:8]),
+		ByteRate:      binary.LittleEndian.Uint32(body[8:12]),
+		BlockAlign:    binary.LittleEndian.Uint16(body[12:14]),
+		BitsPerSample: binary.LittleEndian.Uint16(body[14:16]),
+	}
+	// the actual format of WAVE_FORMAT_EXTENSIBLE is the head of the sub format GUID
+	if f.AudioFormat == FORMAT_EXTENSIBLE {
+		if len(body) < 26 {
+			return nil, errors.New("Extensible fmt chunk too short")
+		}
+		f.AudioFormat = binary.LittleEndian.Uint16(body[24:26])
+	}
+
+	if f.Channels == 0 || f.SampleRate == 0 {
+		return nil, errors.New("Invalid channel count or sample rate")
+	}
+	switch {
+	case f.AudioFormat == FORMAT_PCM && (f.BitsPerSample == 8 || f.BitsPerSample == 16 || f.BitsPerSample == 24 || f.BitsPerSample == 32):
+	case f.AudioFormat == FORMAT_FLOAT && (f.BitsPerSample == 32 || f.BitsPerSample == 64):
+	default:
+		return nil, errors.Errorf("Unsupported sample format %d with %d bits", f.AudioFormat, f.BitsPerSample)
+	}
+	if int(f.BlockAlign) != int(f.Channels)*int(f.BitsPerSample)/8 {
+		return nil, errors.New("Block alignment does not match sample format")
+	}
+	return f, nil
+}
+
+func decodeSamples(r io.Reader, f *format) ([]float64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "Reading data chunk failed")
+	}
+
+	bytesPerSample := int(f.BitsPerSample) / 8
+	channels := int(f.Channels)
+	frames := len(data) / int(f.BlockAlign)
+	samples := make([]float64, frames)
+	for i := range samples {
+		sum := 0.0
+		for c := 0; c < channels; c++ {
+			offset := (i*channels + c) * bytesPerSample
+			sum += decodeSample(data[offset:offset+bytesPerSample], f.AudioFormat)
+		}
+		samples[i] = sum / float64(channels)
+	}
+	return samples, nil
+}
+
+func decodeSample(b []byte, audioFormat uint16) float64 {
+	if audioFormat == FORMAT_FLOAT {
+		if len(b) == 8 {
+			return math.Float64frombits(binary.LittleEndian.Uint64(b))
+		}
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	}
+	switch len(b) {
+	case 1:
+		// 8-bit PCM is unsigned
+		return (float64(b[0]) - 128) / 128
+	case 2:
+		return float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+	case 3:
+		v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+		return float64(v) / (1 << 23)
+	default:
+		return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+	}
+}
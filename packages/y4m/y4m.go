@@ -0,0 +1,167 @@
+package y4m
+
+import (
+	"bufio"
+	"github.com/pkg/errors"
+	"image"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	STREAM_MAGIC = "YUV4MPEG2"
+	FRAME_MAGIC  = "FRAME"
+
+	// MAX_PIXELS bounds the frame size to reject headers that would
+	// allocate huge frames, it allows for 8K video.
+	MAX_PIXELS = 1 << 26
+
+	// MAX_HEADER_LENGTH bounds stream and frame header lines.
+	MAX_HEADER_LENGTH = 4096
+)
+
+// ErrInvalidFrameSize is returned for missing, non-positive or oversized
+// frame dimensions.
+var ErrInvalidFrameSize = errors.New("Invalid frame dimensions")
+
+// Reader decodes the frames of a YUV4MPEG2 stream with 8-bit samples.
+type Reader struct {
+	r              *bufio.Reader
+	Width          int
+	Height         int
+	FrameRateNum   int
+	FrameRateDen   int
+	Colorspace     string
+	frameIndex     int64
+	subsampleRatio image.YCbCrSubsampleRatio
+}
+
+// NewReader parses the stream header.
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := &Reader{
+		r:            bufio.NewReaderSize(r, MAX_HEADER_LENGTH),
+		FrameRateNum: 25,
+		FrameRateDen: 1,
+		Colorspace:   "420jpeg",
+	}
+
+	line, err := reader.readHeader()
+	if err != nil {
+		return nil, errors.Wrap(err, "Reading stream header failed")
+	}
+	params := strings.Fields(line)
+	if len(params) == 0 || params[0] != STREAM_MAGIC {
+		return nil, errors.New("Not a YUV4MPEG2 stream")
+	}
+
+	for _, param := range params[1:] {
+		value := param[1:]
+		switch param[0] {
+		case 'W':
+			reader.Width, err = strconv.Atoi(value)
+		case 'H':
+			reader.Height, err = strconv.Atoi(value)
+		case 'F':
+			reader.FrameRateNum, reader.FrameRateDen, err = parseRatio(value)
+		case 'C':
+			reader.Colorspace = value
+		case 'I':
+			if value != "p" && value != "?" {
+				err = errors.Errorf("Unsupported interlacing %q", value)
+			}
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid stream parameter %q", param)
+		}
+	}
+
+	if reader.Width <= 0 || reader.Height <= 0 || reader.Width > MAX_PIXELS/reader.Height {
+		return nil, errors.Wrapf(ErrInvalidFrameSize, "%dx%d", reader.Width, reader.Height)
+	}
+	if reader.FrameRateNum <= 0 || reader.FrameRateDen <= 0 {
+		return nil, errors.New("Invalid frame rate")
+	}
+	switch reader.Colorspace {
+	case "420jpeg", "420paldv", "420mpeg2", "420":
+		reader.subsampleRatio = image.YCbCrSubsampleRatio420
+	case "422":
+		reader.subsampleRatio = image.YCbCrSubsampleRatio422
+	case "444":
+		reader.subsampleRatio = image.YCbCrSubsampleRatio444
+	case "mono":
+	default:
+		return nil, errors.Errorf("Unsupported colorspace %q", reader.Colorspace)
+	}
+	return reader, nil
+}
+
+// ReadFrame returns the next frame and its presentation timestamp. It
+// returns io.EOF after the last frame.
+func (reader *Reader) ReadFrame() (image.Image, time.Duration, error) {
+	// 1. Frame header
+	line, err := reader.readHeader()
+	if err == io.EOF && len(line) == 0 {
+		return nil, 0, io.EOF
+	}
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "Reading frame header failed")
+	}
+	if !strings.HasPrefix(line, FRAME_MAGIC) {
+		return nil, 0, errors.New("Missing frame header")
+	}
+
+	// 2. Planes
+	rect := image.Rect(0, 0, reader.Width, reader.Height)
+	var img image.Image
+	if reader.Colorspace == "mono" {
+		gray := image.NewGray(rect)
+		if _, err = io.ReadFull(reader.r, gray.Pix); err != nil {
+			return nil, 0, errors.Wrap(err, "Reading frame failed")
+		}
+		img = gray
+	} else {
+		ycbcr := image.NewYCbCr(rect, reader.subsampleRatio)
+		for _, plane := range [][]byte{ycbcr.Y, ycbcr.Cb, ycbcr.Cr} {
+			if _, err = io.ReadFull(reader.r, plane); err != nil {
+				return nil, 0, errors.Wrap(err, "Reading frame failed")
+			}
+		}
+		img = ycbcr
+	}
+
+	// 3. Timestamp from frame index and frame rate
+	timestamp := new(big.Int).SetInt64(reader.frameIndex)
+	timestamp.Mul(timestamp, big.NewInt(int64(time.Second)))
+	timestamp.Mul(timestamp, big.NewInt(int64(reader.FrameRateDen)))
+	timestamp.Quo(timestamp, big.NewInt(int64(reader.FrameRateNum)))
+	if timestamp.Cmp(big.NewInt(math.MaxInt64)) > 0 {
+		return nil, 0, errors.Errorf("Timestamp of frame %d out of range", reader.frameIndex)
+	}
+	reader.frameIndex++
+	return img, time.Duration(timestamp.Int64()), nil
+}
+
+// readHeader reads a header line of at most MAX_HEADER_LENGTH bytes.
+func (reader *Reader) readHeader() (string, error) {
+	line, err := reader.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", errors.Errorf("Header exceeds %d bytes", MAX_HEADER_LENGTH)
+	}
+	return string(line), err
+}
+
+func parseRatio(value string) (num, den int, err error) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return 0, 0, errors.New("Ratio must be formatted as num:den")
+	}
+	if num, err = strconv.Atoi(parts[0]); err != nil {
+		return
+	}
+	den, err = strconv.Atoi(parts[1])
+	return
+}
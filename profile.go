@@ -0,0 +1,65 @@
+package iscc
+
+import (
+	"github.com/coblo/iscc-golang/packages/cdc"
+	"time"
+)
+
+const (
+	IMAGE_SIZE           = 32
+	DEFAULT_PROFILE_NAME = "default"
+)
+
+// Profile holds the parameters of the generators. Generators are available
+// as methods of a Profile, the package level functions use DefaultProfile
+// which produces codes according to the ISCC specification.
+type Profile struct {
+	// Name identifies the profile in generated codes. Encoded codes do not
+	// contain their profile, so it is lost by String and ParseISCC.
+	Name              string
+	InputTrim         int
+	WindowSizeMid     int
+	WindowSizeCidT    int
+	ImageSize         int
+	VideoInterval     time.Duration
+	InstanceChunkSize int
+	Chunking          cdc.Params
+}
+
+var DefaultProfile = Profile{
+	Name:              DEFAULT_PROFILE_NAME,
+	InputTrim:         INPUT_TRIM,
+	WindowSizeMid:     WINDOW_SIZE_MID,
+	WindowSizeCidT:    WINDOW_SIZE_CID_T,
+	ImageSize:         IMAGE_SIZE,
+	VideoInterval:     VIDEO_SAMPLE_INTERVAL,
+	InstanceChunkSize: INSTANCE_CHUNK_SIZE,
+	Chunking:          cdc.DefaultParams,
+}
+
+// Validate checks that the parameters can produce codes. Errors are
+// ProfileErrors.
+func (p Profile) Validate() error {
+	reason := ""
+	switch {
+	case p.Name == "":
+		reason = "Profile needs a name"
+	case p.InputTrim < 4:
+		reason = "Input trim must be 4 bytes or more"
+	case p.WindowSizeMid < 2 || p.WindowSizeCidT < 2:
+		return &ProfileError{p.Name, ErrInvalidWindowWidth.Error(), ErrInvalidWindowWidth}
+	case p.ImageSize < 8:
+		reason = "Image size must be 8 or bigger"
+	case p.VideoInterval <= 0:
+		reason = "Video sample interval must be positive"
+	case p.InstanceChunkSize < 1:
+		reason = "Instance chunk size must be positive"
+	}
+	if reason != "" {
+		return &ProfileError{p.Name, reason, nil}
+	}
+	if err := p.Chunking.Validate(); err != nil {
+		return &ProfileError{p.Name, err.Error(), err}
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package iscc
+
+import (
+	"github.com/coblo/iscc-golang/packages/base58"
+	"github.com/coblo/iscc-golang/packages/epub"
+	"github.com/coblo/iscc-golang/packages/office"
+	"github.com/pkg/errors"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Header range reserved for private experimental Content-ID components.
+// Generators registered by applications must use headers of this range.
+const (
+	HEAD_PRIVATE_MIN byte = 0xf0
+	HEAD_PRIVATE_MAX byte = 0xff
+)
+
+// GMT_PRIVATE is the generic media type reported for private components.
+const GMT_PRIVATE = -1
+
+// ContentGenerator creates Content-ID digests for the media types it handles.
+type ContentGenerator interface {
+	// Name identifies the component, e.g. "Content-ID Text".
+	Name() string
+	// MediaTypes lists the MIME types without parameters the generator handles.
+	MediaTypes() []string
+	// Header is the component header byte, PartialHeader the header with
+	// the partial content flag.
+	Header() byte
+	PartialHeader() byte
+	// Generate returns the 8-byte digest of the content read from r.
+	Generate(r io.Reader) ([]byte, error)
+}
+
+var registry = struct {
+	sync.RWMutex
+	headers    map[byte]ContentGenerator
+	mediaTypes map[string]ContentGenerator
+}{
+	headers:    make(map[byte]ContentGenerator),
+	mediaTypes: make(map[string]ContentGenerator),
+}
+
+func init() {
+	for _, g := range []builtinGenerator{
+		{"Content-ID Text", GMT_TEXT, append([]string{"text/plain", "text/html"}, office.MediaTypes...), DefaultProfile},
+		{"Content-ID Image", GMT_IMAGE, []string{"image/jpeg", "image/png", "image/gif"}, DefaultProfile},
+		{"Content-ID Audio", GMT_AUDIO, []string{"audio/wave"}, DefaultProfile},
+		{"Content-ID Video", GMT_VIDEO, []string{MEDIA_TYPE_Y4M}, DefaultProfile},
+		{"Content-ID Mixed", GMT_MIXED, []string{epub.MEDIA_TYPE}, DefaultProfile},
+	} {
+		if err := register(g); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterContentGenerator adds a generator for private experimental
+// components. Its headers must be in the range HEAD_PRIVATE_MIN to
+// HEAD_PRIVATE_MAX, headers and media types must not be registered yet.
+// The header must be even and the partial header the header with the
+// lowest bit set.
+func RegisterContentGenerator(g ContentGenerator) error {
+	for _, head := range []byte{g.Header(), g.PartialHeader()} {
+		if head < HEAD_PRIVATE_MIN || head > HEAD_PRIVATE_MAX {
+			return errors.Wrapf(&HeaderError{head}, "Outside of private range 0x%02x-0x%02x", HEAD_PRIVATE_MIN, HEAD_PRIVATE_MAX)
+		}
+	}
+	return register(g)
+}
+
+func register(g ContentGenerator) error {
+	registry.Lock()
+	defer registry.Unlock()
+
+	// 1. Check for conflicts, components are compared by header without
+	// the partial content flag
+	if g.Header()&1 != 0 || g.PartialHeader() != g.Header()|1 {
+		return errors.Wrapf(&HeaderError{g.PartialHeader()}, "Header must be even and partial header header|1, got 0x%02x", g.Header())
+	}
+	for _, head := range []byte{g.Header(), g.PartialHeader()} {
+		if _, ok := registry.headers[head]; ok {
+			return errors.Wrapf(ErrAlreadyRegistered, "Header 0x%02x", head)
+		}
+	}
+	for _, mediaType := range g.MediaTypes() {
+		if _, ok := registry.mediaTypes[mediaType]; ok {
+			return errors.Wrapf(ErrAlreadyRegistered, "Media type %s", mediaType)
+		}
+	}
+
+	// 2. Register
+	registry.headers[g.Header()] = g
+	registry.headers[g.PartialHeader()] = g
+	for _, mediaType := range g.MediaTypes() {
+		registry.mediaTypes[mediaType] = g
+	}
+	return nil
+}
+
+// unregister removes the headers and media types of a generator
+// registered before.
+func unregister(g ContentGenerator) {
+	registry.Lock()
+	defer registry.Unlock()
+	delete(registry.headers, g.Header())
+	delete(registry.headers, g.PartialHeader())
+	for _, mediaType := range g.MediaTypes() {
+		delete(registry.mediaTypes, mediaType)
+	}
+}
+
+// ContentGeneratorForHeader returns the generator of a component header.
+func ContentGeneratorForHeader(head byte) (ContentGenerator, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	g, ok := registry.headers[head]
+	return g, ok
+}
+
+// ContentGeneratorForMediaType returns the generator for a MIME type without parameters.
+func ContentGeneratorForMediaType(mediaType string) (ContentGenerator, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	g, ok := registry.mediaTypes[mediaType]
+	return g, ok
+}
+
+// ContentGenerators returns all registered generators ordered by header.
+func ContentGenerators() []ContentGenerator {
+	registry.RLock()
+	defer registry.RUnlock()
+	var generators []ContentGenerator
+	for head, g := range registry.headers {
+		if head == g.Header() {
+			generators = append(generators, g)
+		}
+	}
+	sort.Slice(generators, func(i, j int) bool { return generators[i].Header() < generators[j].Header() })
+	return generators
+}
+
+// generateContentId encodes the digest of a generator with its header.
+// Builtin generators pick the header from the content, e.g. EPUB without
+// significant images get a text Content-ID, and return the metadata
+// suggested by documents.
+func generateContentId(g ContentGenerator, r io.Reader, partial bool) (string, metadata, error) {
+	if builtin, ok := g.(builtinGenerator); ok {
+		return builtin.profile.contentGenerator(builtin.gmt)(r, partial)
+	}
+	digest, err := g.Generate(r)
+	if err != nil {
+		return "", metadata{}, err
+	}
+	if len(digest) != 8 {
+		return "", metadata{}, errors.Wrapf(ErrInvalidDigestLength, "%s generated %d bytes instead of 8", g.Name(), len(digest))
+	}
+	head := g.Header()
+	if partial {
+		head = g.PartialHeader()
+	}
+	cid, err := base58.Encode(append([]byte{head}, digest...))
+	return cid, metadata{}, err
+}
+
+// headerGmt returns the generic media type of a Content-ID header.
+func headerGmt(head byte) int {
+	if head >= HEAD_CID_T && head <= HEAD_CID_M_PCF {
+		return int(head&0x0f) >> 1
+	}
+	return GMT_PRIVATE
+}
+
+// builtinGenerator wraps the Content-ID generator of a generic media type.
+type builtinGenerator struct {
+	name       string
+	gmt        int
+	mediaTypes []string
+	profile    Profile
+}
+
+func (g builtinGenerator) Name() string {
+	return g.name
+}
+
+func (g builtinGenerator) MediaTypes() []string {
+	return g.mediaTypes
+}
+
+func (g builtinGenerator) Header() byte {
+	return HEAD_CID_T | byte(g.gmt<<1)
+}
+
+func (g builtinGenerator) PartialHeader() byte {
+	return g.Header() | 1
+}
+
+func (g builtinGenerator) Generate(r io.Reader) ([]byte, error) {
+	code, _, err := g.profile.contentGenerator(g.gmt)(r, false)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := base58.Decode(code)
+	if err != nil {
+		return nil, err
+	}
+	return digest[1:], nil
+}
+
+// withProfile returns g using the parameters of p if g is a builtin generator.
+func withProfile(g ContentGenerator, p Profile) ContentGenerator {
+	if builtin, ok := g.(builtinGenerator); ok {
+		builtin.profile = p
+		return builtin
+	}
+	return g
+}